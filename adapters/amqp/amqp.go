@@ -0,0 +1,305 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	defaultExchange      = "logspout"
+	defaultExchangeType  = "topic"
+	defaultRoutingKey    = "{{.ContainerName}}"
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	confirmTimeout       = 30 * time.Second
+)
+
+var hostname string
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewAmqpAdapter, "amqp")
+	router.SecretOptions("amqp.password")
+}
+
+// NewAmqpAdapter returns a configured amqp.Adapter
+func NewAmqpAdapter(route *router.Route) (router.LogAdapter, error) {
+	a, err := newAdapter(route)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.connect(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newAdapter returns an adapter configured by the options of a route, without its connection
+func newAdapter(route *router.Route) (*Adapter, error) {
+	transport, found := router.AdapterTransports.Lookup(route.AdapterTransport("tcp"))
+	if !found {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:        route,
+		transport:    transport,
+		exchange:     route.Options["amqp.exchange"],
+		exchangeType: route.Options["amqp.exchange_type"],
+		persistent:   route.Options["amqp.persistent"] == "true",
+		confirm:      route.Options["amqp.confirm"] == "true",
+	}
+	if a.exchange == "" {
+		a.exchange = defaultExchange
+	}
+	if a.exchangeType == "" {
+		a.exchangeType = defaultExchangeType
+	}
+	username := route.Options["amqp.username"]
+	password := route.Options["amqp.password"]
+	if username == "" {
+		username = cfg.GetEnvDefault("AMQP_USERNAME", "guest")
+		password = cfg.GetEnvDefault("AMQP_PASSWORD", "guest")
+	}
+	// the connection is plain AMQP over the route's transport, which
+	// handles TLS for amqp+tls routes
+	a.url = "amqp://" + url.UserPassword(username, password).String() + "@" + route.Address
+
+	routingKey := route.Options["amqp.routing_key"]
+	if routingKey == "" {
+		routingKey = defaultRoutingKey
+	}
+	var err error
+	if a.routingKey, err = template.New("routing_key").Parse(routingKey); err != nil {
+		return nil, errors.New("bad amqp.routing_key: " + err.Error())
+	}
+	if tmplStr := route.Options["amqp.template"]; tmplStr != "" {
+		if a.tmpl, err = template.New("amqp").Parse(tmplStr); err != nil {
+			return nil, errors.New("bad amqp.template: " + err.Error())
+		}
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Adapter publishes log messages to an AMQP exchange, such as one of RabbitMQ
+type Adapter struct {
+	route         *router.Route
+	transport     router.AdapterTransport
+	url           string
+	conn          *amqp.Connection
+	ch            *amqp.Channel
+	confirms      chan amqp.Confirmation
+	published     uint64 // delivery tag of the last message published on ch
+	exchange      string
+	exchangeType  string
+	routingKey    *template.Template
+	tmpl          *template.Template
+	persistent    bool
+	confirm       bool
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// connect opens a channel, declaring the exchange of the route and putting
+// the channel in confirm mode when publisher confirms are enabled
+func (a *Adapter) connect() error {
+	conn, err := amqp.DialConfig(a.url, amqp.Config{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return a.transport.Dial(addr, a.route.Options)
+		},
+		Properties: amqp.Table{"connection_name": "logspout"},
+	})
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err == nil {
+		err = ch.ExchangeDeclare(a.exchange, a.exchangeType, true, false, false, false, nil)
+	}
+	if err == nil && a.confirm {
+		err = ch.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	a.conn = conn
+	a.ch = ch
+	a.published = 0
+	if a.confirm {
+		a.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, a.batchSize))
+	}
+	return nil
+}
+
+func (a *Adapter) close() {
+	a.conn.Close()
+	a.conn = nil
+	a.ch = nil
+}
+
+// Stream publishes batches of log messages
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	defer func() {
+		if a.conn != nil {
+			a.close()
+		}
+	}()
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+// publishing is a message published with its routing key
+type publishing struct {
+	key string
+	msg amqp.Publishing
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	pubs := make([]publishing, 0, len(batch))
+	for _, message := range batch {
+		pub, err := a.newPublishing(message)
+		if err != nil {
+			log.Println("amqp:", err)
+			continue
+		}
+		pubs = append(pubs, pub)
+	}
+	err := a.route.Retry(a.retries, func() error {
+		var err error
+		pubs, err = a.publish(pubs)
+		return err
+	}, batch...)
+	if err != nil {
+		log.Printf("amqp: dropping %d messages: %v", len(pubs), err)
+		a.route.CountWriteError()
+	}
+}
+
+// publish publishes messages, reconnecting first after a failure, and waits
+// for their confirms when enabled. It returns the messages to retry along
+// with an error when some or all of them failed.
+func (a *Adapter) publish(pubs []publishing) ([]publishing, error) {
+	if len(pubs) == 0 {
+		return nil, nil
+	}
+	if a.ch == nil {
+		if err := a.connect(); err != nil {
+			return pubs, err
+		}
+	}
+	first := a.published + 1
+	for _, pub := range pubs {
+		if err := a.ch.Publish(a.exchange, pub.key, false, false, pub.msg); err != nil {
+			a.close()
+			return pubs, err
+		}
+		a.published++
+	}
+	if !a.confirm {
+		return nil, nil
+	}
+	acked := make([]bool, len(pubs))
+	err := a.waitConfirms(first, acked)
+	var retry []publishing
+	for i, pub := range pubs {
+		if !acked[i] {
+			retry = append(retry, pub)
+		}
+	}
+	if len(retry) == 0 {
+		return nil, nil
+	}
+	if err == nil {
+		err = errors.New("rejected by the broker")
+	}
+	return retry, fmt.Errorf("%d of %d messages not confirmed: %v", len(retry), len(pubs), err)
+}
+
+// waitConfirms waits for the confirms of the messages published from the
+// delivery tag first, marking the acknowledged ones. The connection is closed
+// when some confirms are missing, so that they are published again on a new
+// channel.
+func (a *Adapter) waitConfirms(first uint64, acked []bool) error {
+	timeout := time.NewTimer(confirmTimeout)
+	defer timeout.Stop()
+	for range acked {
+		select {
+		case confirm, ok := <-a.confirms:
+			if !ok {
+				a.close()
+				return errors.New("channel closed")
+			}
+			if i := confirm.DeliveryTag - first; i < uint64(len(acked)) {
+				acked[i] = confirm.Ack
+			}
+		case <-timeout.C:
+			a.close()
+			return errors.New("timeout waiting for confirms")
+		}
+	}
+	return nil
+}
+
+func (a *Adapter) newPublishing(message *router.Message) (publishing, error) {
+	m := &Message{message}
+	var key bytes.Buffer
+	if err := a.routingKey.Execute(&key, m); err != nil {
+		return publishing{}, err
+	}
+	msg := amqp.Publishing{
+		AppId:     "logspout",
+		Timestamp: message.Time,
+	}
+	if a.persistent {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	if a.tmpl != nil {
+		var buf bytes.Buffer
+		if err := a.tmpl.Execute(&buf, m); err != nil {
+			return publishing{}, err
+		}
+		msg.ContentType = "text/plain"
+		msg.Body = buf.Bytes()
+	} else {
+		body, err := json.Marshal(router.NewRecord(message, hostname))
+		if err != nil {
+			return publishing{}, err
+		}
+		msg.ContentType = "application/json"
+		msg.Body = body
+	}
+	return publishing{key.String(), msg}, nil
+}
+
+// Message extends router.Message for routing key and message templates
+type Message struct {
+	*router.Message
+}
+
+// ContainerName returns the message's container name
+func (m *Message) ContainerName() string {
+	if m.Container == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Container.Name, "/")
+}
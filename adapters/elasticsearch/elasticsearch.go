@@ -0,0 +1,255 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	defaultIndex         = "logspout-{{.Date}}"
+	defaultDateLayout    = "2006.01.02"
+	defaultBatchSize     = 500
+	defaultBatchInterval = time.Second
+	requestTimeout       = 30 * time.Second
+)
+
+var hostname string
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewElasticsearchAdapter, "elasticsearch")
+	router.AdapterFactories.Register(NewElasticsearchAdapter, "opensearch")
+	router.SecretOptions("es.password")
+}
+
+// NewElasticsearchAdapter returns a configured elasticsearch.Adapter
+func NewElasticsearchAdapter(route *router.Route) (router.LogAdapter, error) {
+	scheme := route.AdapterTransport("http")
+	if scheme != "http" && scheme != "https" {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:    route,
+		url:      scheme + "://" + strings.TrimSuffix(route.Address+route.Path, "/") + "/_bulk",
+		client:   &http.Client{Timeout: requestTimeout},
+		username: route.Options["es.username"],
+		password: route.Options["es.password"],
+		action:   route.Options["es.action"],
+	}
+	if a.username == "" {
+		a.username = cfg.GetEnvDefault("ELASTICSEARCH_USERNAME", "")
+		a.password = cfg.GetEnvDefault("ELASTICSEARCH_PASSWORD", "")
+	}
+	switch a.action {
+	case "":
+		a.action = "index"
+	case "index", "create":
+	default:
+		return nil, errors.New("bad es.action: " + a.action)
+	}
+
+	index := route.Options["es.index"]
+	if index == "" {
+		index = defaultIndex
+	}
+	var err error
+	if a.index, err = template.New("index").Option("missingkey=zero").Parse(index); err != nil {
+		return nil, errors.New("bad es.index: " + err.Error())
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Adapter indexes log messages in Elasticsearch or OpenSearch with the bulk API
+type Adapter struct {
+	route         *router.Route
+	url           string
+	client        *http.Client
+	username      string
+	password      string
+	action        string
+	index         *template.Template
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// Stream sends batches of log messages to the bulk API
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	var items []bulkItem
+	for _, message := range batch {
+		item, err := a.newItem(message)
+		if err != nil {
+			log.Println("elasticsearch:", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	err := a.route.Retry(a.retries, func() error {
+		var err error
+		items, err = a.send(items)
+		return err
+	}, batch...)
+	if err != nil {
+		log.Printf("elasticsearch: dropping %d messages: %v", len(items), err)
+		a.route.CountWriteError()
+	}
+}
+
+// bulkItem is an action and document of a bulk request
+type bulkItem = []byte
+
+func (a *Adapter) newItem(message *router.Message) (bulkItem, error) {
+	var index bytes.Buffer
+	if err := a.index.Execute(&index, &Message{message}); err != nil {
+		return nil, err
+	}
+	action, err := json.Marshal(map[string]interface{}{
+		a.action: map[string]string{"_index": strings.ToLower(index.String())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(NewDocument(message))
+	if err != nil {
+		return nil, err
+	}
+	item := append(action, '\n')
+	item = append(item, doc...)
+	return append(item, '\n'), nil
+}
+
+// bulkResponse is the part of the response of the bulk API telling which items failed
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// send posts items to the bulk API. It returns the items to retry along with
+// an error when some or all of them failed, dropping items rejected for good.
+func (a *Adapter) send(items []bulkItem) ([]bulkItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(bytes.Join(items, nil)))
+	if err != nil {
+		return items, router.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if a.username != "" {
+		req.SetBasicAuth(a.username, a.password)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return items, err
+	}
+	defer resp.Body.Close()
+	if err := router.CheckHTTPResponse(resp); err != nil {
+		return items, err
+	}
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return items, router.Permanent(err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	if len(result.Items) != len(items) {
+		return items, router.Permanent(errors.New("bulk response doesn't match the request"))
+	}
+	var retry []bulkItem
+	var lastErr string
+	for i, item := range result.Items {
+		for _, status := range item {
+			switch {
+			case status.Status < 300:
+			case status.Status == http.StatusTooManyRequests || status.Status >= 500:
+				retry = append(retry, items[i])
+				lastErr = string(status.Error)
+			default:
+				log.Printf("elasticsearch: dropping message rejected with status %d: %s", status.Status, status.Error)
+			}
+		}
+	}
+	if len(retry) == 0 {
+		return nil, nil
+	}
+	return retry, fmt.Errorf("%d of %d messages failed: %s", len(retry), len(items), lastErr)
+}
+
+// Message extends router.Message for the index template
+type Message struct {
+	*router.Message
+}
+
+// Date returns the UTC date of the message in the given layout, or as
+// 2006.01.02 by default
+func (m *Message) Date(layout ...string) string {
+	if len(layout) > 0 {
+		return m.Time.UTC().Format(layout[0])
+	}
+	return m.Time.UTC().Format(defaultDateLayout)
+}
+
+// Document is an indexed log message
+type Document struct {
+	Timestamp time.Time               `json:"@timestamp"`
+	Message   string                  `json:"message"`
+	Source    string                  `json:"source"`
+	Host      string                  `json:"host"`
+	Container *router.RecordContainer `json:"container,omitempty"`
+	Fields    map[string]interface{}  `json:"fields,omitempty"`
+}
+
+// NewDocument returns the document indexed for a log message
+func NewDocument(message *router.Message) *Document {
+	doc := &Document{
+		Timestamp: message.Time,
+		Message:   message.Data,
+		Source:    message.Source,
+		Host:      hostname,
+		Container: router.NewRecordContainer(message.Container),
+		Fields:    message.Fields,
+	}
+	if doc.Container != nil {
+		doc.Container.Labels = dedotLabels(doc.Container.Labels)
+	}
+	return doc
+}
+
+// dedotLabels replaces the dots in label names with underscores, since
+// Elasticsearch would map labels like com.docker.compose.project and
+// com.docker.compose.project.working_dir to conflicting objects
+func dedotLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	dedotted := make(map[string]string, len(labels))
+	for key, value := range labels {
+		dedotted[strings.Replace(key, ".", "_", -1)] = value
+	}
+	return dedotted
+}
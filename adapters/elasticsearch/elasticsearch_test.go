@@ -0,0 +1,200 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+)
+
+var container = &docker.Container{
+	ID:   "8dfafdbc3a40",
+	Name: "/app",
+	Config: &docker.Config{
+		Image:  "nginx:1.21",
+		Labels: map[string]string{"team": "web", "com.docker.compose.project": "shop"},
+	},
+}
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+}
+
+// bulkServer records the bulk requests it receives, and answers each item
+// with the next status of statuses, or 201 when there are none left
+type bulkServer struct {
+	sync.Mutex
+	statuses []int
+	actions  []map[string]map[string]string
+	docs     []map[string]interface{}
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var items []string
+	errors := false
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		json.Unmarshal(scanner.Bytes(), &action)
+		scanner.Scan()
+		var doc map[string]interface{}
+		json.Unmarshal(scanner.Bytes(), &doc)
+		status := 201
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		if status < 300 {
+			s.actions = append(s.actions, action)
+			s.docs = append(s.docs, doc)
+		} else {
+			errors = true
+		}
+		items = append(items, fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"test"}}}`, status))
+	}
+	fmt.Fprintf(w, `{"errors":%v,"items":[%s]}`, errors, strings.Join(items, ","))
+}
+
+func newTestAdapter(t *testing.T, srv *httptest.Server, options map[string]string) *Adapter {
+	route := &router.Route{
+		Adapter: "elasticsearch",
+		Address: strings.TrimPrefix(srv.URL, "http://"),
+		Options: options,
+	}
+	adapter, err := NewElasticsearchAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter.(*Adapter)
+}
+
+func streamMessages(adapter *Adapter, data ...string) {
+	messages := make([]*router.Message, len(data))
+	for i, d := range data {
+		messages[i] = &router.Message{
+			Container: container,
+			Source:    "stdout",
+			Data:      d,
+			Time:      time.Date(2021, 12, 3, 10, 0, 0, 0, time.UTC),
+		}
+	}
+	routertest.Stream(adapter, messages...)
+}
+
+func TestElasticsearchBulk(t *testing.T) {
+	s := &bulkServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	adapter := newTestAdapter(t, srv, map[string]string{
+		"es.index":   "logs-{{.Container.Config.Labels.team}}-{{.Date}}",
+		"batch.size": "2",
+	})
+	streamMessages(adapter, "one", "two", "three")
+
+	if len(s.docs) != 3 {
+		t.Fatalf("expected 3 documents got %d", len(s.docs))
+	}
+	if index := s.actions[0]["index"]["_index"]; index != "logs-web-2021.12.03" {
+		t.Errorf("expected index logs-web-2021.12.03 got %s", index)
+	}
+	doc := s.docs[0]
+	if doc["message"] != "one" || doc["source"] != "stdout" || doc["@timestamp"] != "2021-12-03T10:00:00Z" {
+		t.Errorf("unexpected document %v", doc)
+	}
+	c := doc["container"].(map[string]interface{})
+	labels := c["labels"].(map[string]interface{})
+	if c["name"] != "app" || c["id"] != "8dfafdbc3a40" || c["image"] != "nginx:1.21" ||
+		labels["team"] != "web" || labels["com_docker_compose_project"] != "shop" {
+		t.Errorf("unexpected container %v", c)
+	}
+}
+
+func TestElasticsearchPartialFailure(t *testing.T) {
+	// the second item is throttled then accepted, the third is rejected for good
+	s := &bulkServer{statuses: []int{201, 429, 400, 201}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	adapter := newTestAdapter(t, srv, map[string]string{"es.action": "create"})
+	streamMessages(adapter, "one", "two", "three")
+
+	if len(s.docs) != 2 || s.docs[0]["message"] != "one" || s.docs[1]["message"] != "two" {
+		t.Errorf("expected documents one and two got %v", s.docs)
+	}
+	if _, ok := s.actions[1]["create"]; !ok {
+		t.Errorf("expected create action got %v", s.actions[1])
+	}
+}
+
+func TestElasticsearchRetryUnavailable(t *testing.T) {
+	s := &bulkServer{}
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	adapter := newTestAdapter(t, srv, nil)
+	streamMessages(adapter, "one")
+
+	if len(s.docs) != 1 {
+		t.Errorf("expected document to be indexed after retries, got %d documents", len(s.docs))
+	}
+}
+
+func TestElasticsearchBadOptions(t *testing.T) {
+	for _, tc := range []struct {
+		adapter string
+		options map[string]string
+	}{
+		{"elasticsearch+udp", nil},
+		{"elasticsearch", map[string]string{"es.action": "update"}},
+		{"elasticsearch", map[string]string{"es.index": "{{"}},
+		{"elasticsearch", map[string]string{"batch.size": "0"}},
+		{"elasticsearch", map[string]string{"retry.count": "many"}},
+	} {
+		route := &router.Route{Adapter: tc.adapter, Address: "localhost:9200", Options: tc.options}
+		if _, err := NewElasticsearchAdapter(route); err == nil {
+			t.Errorf("expected error for %s with options %v", tc.adapter, tc.options)
+		}
+	}
+}
+
+func TestElasticsearchIndexMissingLabel(t *testing.T) {
+	s := &bulkServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	adapter := newTestAdapter(t, srv, map[string]string{
+		"es.index": "Logs-{{.Container.Config.Labels.team}}-{{.Date \"2006-01\"}}",
+	})
+	routertest.Stream(adapter, &router.Message{
+		Container: &docker.Container{Name: "/app", Config: &docker.Config{}},
+		Data:      "one",
+		Time:      time.Date(2021, 12, 3, 10, 0, 0, 0, time.UTC),
+	})
+
+	if len(s.actions) != 1 {
+		t.Fatalf("expected 1 document got %d", len(s.actions))
+	}
+	if index := s.actions[0]["index"]["_index"]; index != "logs--2021-12" {
+		t.Errorf("expected index logs--2021-12 got %s", index)
+	}
+}
@@ -0,0 +1,318 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	defaultTemplate = "{{.Data}}\n"
+	defaultMaxSize  = 100 << 20
+	defaultMaxFiles = 5
+
+	// files not written to for idleTimeout are closed, so routes with a
+	// file per container don't keep those of stopped containers open
+	idleTimeout  = time.Minute
+	tickInterval = 10 * time.Second
+)
+
+var funcs = template.FuncMap{
+	"toJSON": func(value interface{}) string {
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			log.Println("error marshaling to JSON: ", err)
+			return "null"
+		}
+		return string(bytes)
+	},
+}
+
+func init() {
+	router.AdapterFactories.Register(NewFileAdapter, "file")
+}
+
+// NewFileAdapter returns a configured file.Adapter
+func NewFileAdapter(route *router.Route) (router.LogAdapter, error) {
+	path := route.Address + route.Path
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("bad file path: " + path + " is not absolute")
+	}
+	a := &Adapter{
+		route:    route,
+		compress: route.Options["file.compress"] == "true",
+		files:    make(map[string]*logFile),
+	}
+	var err error
+	if a.path, err = template.New("path").Funcs(funcs).Parse(path); err != nil {
+		return nil, errors.New("bad file path: " + err.Error())
+	}
+	// rendered paths must stay in the directory before the first action of
+	// the path, as the values rendered, like labels, may hold ../
+	if i := strings.Index(path, "{{"); i >= 0 {
+		path = path[:i]
+	}
+	a.dir = filepath.Dir(path)
+	tmplStr := route.Options["file.template"]
+	if tmplStr == "" {
+		tmplStr = cfg.GetEnvDefault("FILE_TEMPLATE", defaultTemplate)
+	}
+	if a.tmpl, err = template.New("file").Funcs(funcs).Parse(tmplStr); err != nil {
+		return nil, errors.New("bad file.template: " + err.Error())
+	}
+	if a.maxSize, err = route.SizeOption("file.max_size", defaultMaxSize); err != nil {
+		return nil, err
+	}
+	if a.maxAge, err = route.DurationOption("file.max_age", 0); err != nil {
+		return nil, err
+	}
+	if a.maxFiles, err = route.IntOption("file.max_files", defaultMaxFiles); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Adapter writes log messages to files on the host, rotating them by size or age
+type Adapter struct {
+	route    *router.Route
+	path     *template.Template
+	dir      string // directory rendered paths must stay in
+	tmpl     *template.Template
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+	files    map[string]*logFile
+
+	compressing sync.WaitGroup // compression of the last rotated file
+}
+
+// logFile is a log file, closed while it is idle. Its open time is kept
+// while it is closed so it still rotates after file.max_age. Files that
+// already exist when first opened count as opened when last modified.
+type logFile struct {
+	path     string
+	file     *os.File
+	size     int64
+	opened   time.Time
+	lastUsed time.Time
+}
+
+// Stream writes log messages to the files their paths are rendered to
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	defer a.closeAll()
+	for {
+		select {
+		case message, ok := <-logstream:
+			if !ok {
+				return
+			}
+			if err := a.write(message, time.Now()); err != nil {
+				log.Println("file:", err)
+				a.route.CountWriteError()
+				continue
+			}
+			a.route.MarkWritten(message)
+		case now := <-ticker.C:
+			a.tick(now)
+		}
+	}
+}
+
+func (a *Adapter) write(message *router.Message, now time.Time) error {
+	var path, buf bytes.Buffer
+	m := &Message{message}
+	if err := a.path.Execute(&path, m); err != nil {
+		return err
+	}
+	if err := a.tmpl.Execute(&buf, m); err != nil {
+		return err
+	}
+	name := filepath.Clean(path.String())
+	if a.dir != "/" && !strings.HasPrefix(name, a.dir+"/") {
+		return fmt.Errorf("dropping message: path %s is outside %s", name, a.dir)
+	}
+	f, err := a.open(name, now)
+	if err != nil {
+		return err
+	}
+	if a.expired(f, now) || (a.maxSize > 0 && f.size > 0 && f.size+int64(buf.Len()) > a.maxSize) {
+		if err := a.rotate(f); err != nil {
+			return err
+		}
+		if f, err = a.open(f.path, now); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(buf.Bytes())
+	f.size += int64(n)
+	f.lastUsed = now
+	return err
+}
+
+// expired returns whether a file is due to be rotated by file.max_age
+func (a *Adapter) expired(f *logFile, now time.Time) bool {
+	return a.maxAge > 0 && f.size > 0 && now.Sub(f.opened) >= a.maxAge
+}
+
+// open returns the open file of a path, creating it and its directory if needed
+func (a *Adapter) open(path string, now time.Time) (*logFile, error) {
+	f, ok := a.files[path]
+	if ok && f.file != nil {
+		return f, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !ok {
+		f = &logFile{path: path, opened: now}
+		if info.Size() > 0 && info.ModTime().Before(now) {
+			f.opened = info.ModTime()
+		}
+		a.files[path] = f
+	}
+	f.file = file
+	f.size = info.Size()
+	f.lastUsed = now
+	return f, nil
+}
+
+// rotate renames a file to its first generation, shifting older generations
+// and removing those beyond file.max_files. The next write opens a new file.
+// With file.compress, the first generation is compressed in the background.
+func (a *Adapter) rotate(f *logFile) error {
+	if f.file != nil {
+		f.file.Close()
+	}
+	delete(a.files, f.path)
+	// generations are only shifted once the last one is compressed
+	a.compressing.Wait()
+	ext := ""
+	if a.compress {
+		ext = ".gz"
+	}
+	generation := func(i int) string {
+		return f.path + "." + strconv.Itoa(i) + ext
+	}
+	if a.maxFiles == 0 {
+		return os.Remove(f.path)
+	}
+	os.Remove(generation(a.maxFiles))
+	for i := a.maxFiles - 1; i > 0; i-- {
+		if err := os.Rename(generation(i), generation(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !a.compress {
+		return os.Rename(f.path, generation(1))
+	}
+	rotated := f.path + ".1.tmp"
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	a.compressing.Add(1)
+	go func() {
+		defer a.compressing.Done()
+		if err := compressFile(rotated, generation(1)); err != nil {
+			log.Println("file:", err)
+		}
+	}()
+	return nil
+}
+
+// compressFile writes a file gzipped to dst, then removes it
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(out)
+	_, err = io.Copy(w, in)
+	if err == nil {
+		err = w.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(dst+".tmp", dst)
+	}
+	if err != nil {
+		os.Remove(dst + ".tmp")
+		return err
+	}
+	return os.Remove(src)
+}
+
+// tick rotates files older than file.max_age and closes idle files, forgetting
+// them unless they are still to be rotated
+func (a *Adapter) tick(now time.Time) {
+	for path, f := range a.files {
+		if a.expired(f, now) {
+			if err := a.rotate(f); err != nil {
+				log.Println("file:", err)
+			}
+			continue
+		}
+		if f.file != nil && now.Sub(f.lastUsed) >= idleTimeout {
+			f.file.Close()
+			f.file = nil
+			if a.maxAge == 0 || f.size == 0 {
+				delete(a.files, path)
+			}
+		}
+	}
+}
+
+func (a *Adapter) closeAll() {
+	for path, f := range a.files {
+		if f.file != nil {
+			f.file.Close()
+		}
+		delete(a.files, path)
+	}
+	a.compressing.Wait()
+}
+
+// Message extends router.Message for path and message templates
+type Message struct {
+	*router.Message
+}
+
+// ContainerName returns the message's container name
+func (m *Message) ContainerName() string {
+	if m.Container == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Container.Name, "/")
+}
@@ -0,0 +1,197 @@
+package file
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+var (
+	web = &docker.Container{ID: "8dfafdbc3a40", Name: "/web"}
+	db  = &docker.Container{ID: "3b6ba57db54a", Name: "/db"}
+)
+
+func newTestAdapter(t *testing.T, options map[string]string) (*Adapter, string) {
+	dir, err := ioutil.TempDir("", "logspout-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := &router.Route{
+		Adapter: "file",
+		Address: filepath.Join(dir, "{{.ContainerName}}", "{{.Source}}.log"),
+		Options: options,
+	}
+	adapter, err := NewFileAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter.(*Adapter), dir
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestFileStream(t *testing.T) {
+	adapter, dir := newTestAdapter(t, map[string]string{"file.template": "{{.ContainerName}}: {{.Data}}\n"})
+	defer os.RemoveAll(dir)
+	stream := make(chan *router.Message, 3)
+	stream <- &router.Message{Container: web, Source: "stdout", Data: "one"}
+	stream <- &router.Message{Container: db, Source: "stdout", Data: "two"}
+	stream <- &router.Message{Container: web, Source: "stdout", Data: "three"}
+	close(stream)
+	adapter.Stream(stream)
+
+	if content := readFile(t, filepath.Join(dir, "web", "stdout.log")); content != "web: one\nweb: three\n" {
+		t.Errorf("unexpected web log %q", content)
+	}
+	if content := readFile(t, filepath.Join(dir, "db", "stdout.log")); content != "db: two\n" {
+		t.Errorf("unexpected db log %q", content)
+	}
+	if len(adapter.files) != 0 {
+		t.Errorf("expected files to be closed")
+	}
+}
+
+func TestFileRotateSize(t *testing.T) {
+	adapter, dir := newTestAdapter(t, map[string]string{"file.max_size": "8", "file.max_files": "2"})
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	for _, data := range []string{"one", "two", "three", "four"} {
+		if err := adapter.write(&router.Message{Container: web, Source: "stdout", Data: data}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	adapter.closeAll()
+
+	path := filepath.Join(dir, "web", "stdout.log")
+	for p, expected := range map[string]string{
+		path:        "four\n",
+		path + ".1": "three\n",
+		path + ".2": "one\ntwo\n",
+	} {
+		if content := readFile(t, p); content != expected {
+			t.Errorf("expected %q in %s got %q", expected, p, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 generations to be kept")
+	}
+}
+
+func TestFileRotateAgeCompressed(t *testing.T) {
+	adapter, dir := newTestAdapter(t, map[string]string{"file.max_age": "1h", "file.compress": "true"})
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	if err := adapter.write(&router.Message{Container: web, Source: "stderr", Data: "old"}, now); err != nil {
+		t.Fatal(err)
+	}
+	// idle files are closed, yet still rotated once they are old enough
+	adapter.tick(now.Add(idleTimeout))
+	adapter.tick(now.Add(time.Hour))
+	if err := adapter.write(&router.Message{Container: web, Source: "stderr", Data: "new"}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	adapter.closeAll()
+
+	path := filepath.Join(dir, "web", "stderr.log")
+	if content := readFile(t, path); content != "new\n" {
+		t.Errorf("unexpected log %q", content)
+	}
+	f, err := os.Open(path + ".1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(r); string(content) != "old\n" {
+		t.Errorf("unexpected rotated log %q", content)
+	}
+}
+
+func TestFileRotateAgeExisting(t *testing.T) {
+	adapter, dir := newTestAdapter(t, map[string]string{"file.max_age": "1h"})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "web", "stdout.log")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	os.Chtimes(path, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	// a file written before logspout started still rotates by its age
+	if err := adapter.write(&router.Message{Container: web, Source: "stdout", Data: "new"}, now); err != nil {
+		t.Fatal(err)
+	}
+	adapter.closeAll()
+
+	for p, expected := range map[string]string{
+		path:        "new\n",
+		path + ".1": "old\n",
+	} {
+		if content := readFile(t, p); content != expected {
+			t.Errorf("expected %q in %s got %q", expected, p, content)
+		}
+	}
+}
+
+func TestFilePathOutsideDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logspout-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	route := &router.Route{Adapter: "file", Address: dir + "/logs/{{.Container.Config.Labels.team}}.log"}
+	adapter, err := NewFileAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	team := func(team string) *docker.Container {
+		return &docker.Container{Name: "/web", Config: &docker.Config{Labels: map[string]string{"team": team}}}
+	}
+	stream := make(chan *router.Message, 2)
+	stream <- &router.Message{Container: team("../../escaped"), Data: "one"}
+	stream <- &router.Message{Container: team("shop"), Data: "two"}
+	close(stream)
+	adapter.Stream(stream)
+
+	escaped := filepath.Join(dir, "..", "escaped.log")
+	if _, err := os.Stat(escaped); err == nil {
+		os.Remove(escaped)
+		t.Error("expected no file written outside the directory of the path")
+	}
+	if content := readFile(t, filepath.Join(dir, "logs", "shop.log")); content != "two\n" {
+		t.Errorf("unexpected shop log %q", content)
+	}
+	if counters := route.Counters(); counters.WriteErrors != 1 {
+		t.Errorf("expected the message outside the directory to count as a write error, got %d", counters.WriteErrors)
+	}
+}
+
+func TestFileBadOptions(t *testing.T) {
+	for _, route := range []*router.Route{
+		{Adapter: "file", Address: "logs/{{.ContainerName}}.log"},
+		{Adapter: "file", Address: "/logs/{{.ContainerName.log"},
+		{Adapter: "file", Address: "/logs/app.log", Options: map[string]string{"file.max_size": "big"}},
+		{Adapter: "file", Address: "/logs/app.log", Options: map[string]string{"file.max_age": "-1h"}},
+		{Adapter: "file", Address: "/logs/app.log", Options: map[string]string{"file.template": "{{"}},
+	} {
+		if _, err := NewFileAdapter(route); err == nil {
+			t.Errorf("expected error for %s with options %v", route.Address, route.Options)
+		}
+	}
+}
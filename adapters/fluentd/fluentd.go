@@ -0,0 +1,227 @@
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	// ForwardMode sends the entries of a tag as an array of [time, record] pairs
+	ForwardMode = "forward"
+	// PackedForwardMode sends the entries of a tag as a binary stream of [time, record] pairs
+	PackedForwardMode = "packed"
+
+	defaultTag           = "docker.{{.ContainerName}}"
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	defaultAckTimeout    = 30 * time.Second
+)
+
+func init() {
+	router.AdapterFactories.Register(NewFluentdAdapter, "fluentd")
+}
+
+// NewFluentdAdapter returns a configured fluentd.Adapter
+func NewFluentdAdapter(route *router.Route) (router.LogAdapter, error) {
+	transport, found := router.AdapterTransports.Lookup(route.AdapterTransport("tcp"))
+	if !found {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:     route,
+		transport: transport,
+		mode:      route.Options["fluentd.mode"],
+		ack:       route.Options["fluentd.ack"] == "true",
+	}
+	switch a.mode {
+	case "":
+		a.mode = ForwardMode
+	case ForwardMode, PackedForwardMode:
+	default:
+		return nil, errors.New("bad fluentd.mode: " + a.mode)
+	}
+	tag := route.Options["fluentd.tag"]
+	if tag == "" {
+		tag = cfg.GetEnvDefault("FLUENTD_TAG", defaultTag)
+	}
+	var err error
+	if a.tag, err = template.New("tag").Parse(tag); err != nil {
+		return nil, errors.New("bad fluentd.tag: " + err.Error())
+	}
+	if a.ackTimeout, err = route.DurationOption("fluentd.ack_timeout", defaultAckTimeout); err != nil {
+		return nil, err
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	if a.conn, err = transport.Dial(route.Address, route.Options); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Adapter sends log messages to Fluentd or Fluent Bit with the Forward protocol
+type Adapter struct {
+	route         *router.Route
+	transport     router.AdapterTransport
+	conn          net.Conn
+	mode          string
+	tag           *template.Template
+	ack           bool
+	ackTimeout    time.Duration
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// Stream sends batches of log messages, one forward message per tag
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	var tags []string
+	entries := make(map[string][]*router.Message)
+	for _, message := range batch {
+		var tag bytes.Buffer
+		if err := a.tag.Execute(&tag, &Message{message}); err != nil {
+			log.Println("fluentd:", err)
+			continue
+		}
+		if _, ok := entries[tag.String()]; !ok {
+			tags = append(tags, tag.String())
+		}
+		entries[tag.String()] = append(entries[tag.String()], message)
+	}
+	for _, tag := range tags {
+		err := a.route.Retry(a.retries, func() error {
+			return a.send(tag, entries[tag])
+		}, entries[tag]...)
+		if err != nil {
+			log.Printf("fluentd: dropping %d messages: %v", len(entries[tag]), err)
+			a.route.CountWriteError()
+		}
+	}
+}
+
+// send writes a forward message, waiting for its ack when enabled. On
+// failure, it reconnects so the message can be retried.
+func (a *Adapter) send(tag string, messages []*router.Message) error {
+	if a.conn == nil {
+		conn, err := a.transport.Dial(a.route.Address, a.route.Options)
+		if err != nil {
+			return err
+		}
+		a.conn = conn
+	}
+	var chunk string
+	if a.ack {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+	err := a.write(a.encode(tag, messages, chunk), chunk)
+	if err != nil {
+		a.conn.Close()
+		a.conn = nil
+	}
+	return err
+}
+
+func (a *Adapter) write(buf []byte, chunk string) error {
+	if _, err := a.conn.Write(buf); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	if err := a.conn.SetReadDeadline(time.Now().Add(a.ackTimeout)); err != nil {
+		return err
+	}
+	resp, err := readStringMap(bufio.NewReader(a.conn))
+	if err != nil {
+		return errors.New("no ack: " + err.Error())
+	}
+	if resp["ack"] != chunk {
+		return errors.New("bad ack: " + resp["ack"])
+	}
+	return nil
+}
+
+// encode returns the forward message of the entries of a tag:
+// [tag, [[time, record], ...], option] in Forward mode, or
+// [tag, bin([time, record][time, record]...), option] in PackedForward mode
+func (a *Adapter) encode(tag string, messages []*router.Message, chunk string) []byte {
+	var b []byte
+	b = appendArrayHeader(b, 3)
+	b = appendString(b, tag)
+	if a.mode == PackedForwardMode {
+		var entries []byte
+		for _, message := range messages {
+			entries = appendEntry(entries, message)
+		}
+		b = appendBinary(b, entries)
+	} else {
+		b = appendArrayHeader(b, len(messages))
+		for _, message := range messages {
+			b = appendEntry(b, message)
+		}
+	}
+	option := map[string]interface{}{"size": len(messages)}
+	if chunk != "" {
+		option["chunk"] = chunk
+	}
+	return appendMap(b, option)
+}
+
+// appendEntry appends the [time, record] entry of a message
+func appendEntry(b []byte, message *router.Message) []byte {
+	b = appendArrayHeader(b, 2)
+	b = appendEventTime(b, message.Time)
+	return appendMap(b, NewRecord(message))
+}
+
+// NewRecord returns the record of a message, with the keys of the fluentd
+// log driver of Docker and the fields parsed by the route's parse option
+func NewRecord(message *router.Message) map[string]interface{} {
+	record := make(map[string]interface{}, len(message.Fields)+4)
+	for key, value := range message.Fields {
+		record[key] = value
+	}
+	record["log"] = message.Data
+	record["source"] = message.Source
+	if c := message.Container; c != nil {
+		record["container_id"] = c.ID
+		record["container_name"] = c.Name
+	}
+	return record
+}
+
+// Message extends router.Message for tag templates
+type Message struct {
+	*router.Message
+}
+
+// ContainerName returns the message's container name
+func (m *Message) ContainerName() string {
+	if m.Container == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Container.Name, "/")
+}
@@ -0,0 +1,248 @@
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	_ "github.com/gliderlabs/logspout/transports/tcp"
+)
+
+var container = &docker.Container{
+	ID:     "8dfafdbc3a40",
+	Name:   "/app",
+	Config: &docker.Config{Labels: map[string]string{"team": "web"}},
+}
+
+// decode reads a msgpack value, decoding the types the adapter encodes
+func decode(t *testing.T, r *bufio.Reader) interface{} {
+	c, err := r.ReadByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(n int) []byte {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+	length := func(size int) int {
+		n := 0
+		for _, b := range read(size) {
+			n = n<<8 | int(b)
+		}
+		return n
+	}
+	array := func(n int) interface{} {
+		a := make([]interface{}, n)
+		for i := range a {
+			a[i] = decode(t, r)
+		}
+		return a
+	}
+	object := func(n int) interface{} {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key := decode(t, r).(string)
+			m[key] = decode(t, r)
+		}
+		return m
+	}
+	switch {
+	case c < 0x80:
+		return int64(c)
+	case c >= 0xe0:
+		return int64(int8(c))
+	case c&0xf0 == 0x80:
+		return object(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return array(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return string(read(int(c & 0x1f)))
+	}
+	switch c {
+	case 0xc0:
+		return nil
+	case 0xc2:
+		return false
+	case 0xc3:
+		return true
+	case 0xc4:
+		return read(length(1))
+	case 0xc5:
+		return read(length(2))
+	case 0xc6:
+		return read(length(4))
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(read(8)))
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(read(8)))
+	case 0xd7:
+		ext := read(9)
+		return time.Unix(int64(binary.BigEndian.Uint32(ext[1:5])), int64(binary.BigEndian.Uint32(ext[5:])))
+	case 0xd9:
+		return string(read(length(1)))
+	case 0xda:
+		return string(read(length(2)))
+	case 0xdc:
+		return array(length(2))
+	case 0xde:
+		return object(length(2))
+	}
+	t.Fatalf("unexpected msgpack type 0x%x", c)
+	return nil
+}
+
+// startServer accepts a connection and sends the forward messages it reads
+// to received, acknowledging their chunks unless ack is false
+func startServer(t *testing.T, ack bool, received chan<- []interface{}) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			if _, err := r.Peek(1); err != nil {
+				return
+			}
+			msg := decode(t, r).([]interface{})
+			if chunk, ok := msg[2].(map[string]interface{})["chunk"].(string); ok && ack {
+				var b []byte
+				b = appendMapHeader(b, 1)
+				b = appendString(b, "ack")
+				b = appendString(b, chunk)
+				c.Write(b)
+			}
+			received <- msg
+		}
+	}()
+	return l
+}
+
+func newTestAdapter(t *testing.T, l net.Listener, options map[string]string) *Adapter {
+	route := &router.Route{Adapter: "fluentd", Address: l.Addr().String(), Options: options}
+	adapter, err := NewFluentdAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter.(*Adapter)
+}
+
+func TestFluentdForward(t *testing.T) {
+	received := make(chan []interface{}, 1)
+	l := startServer(t, true, received)
+	defer l.Close()
+	adapter := newTestAdapter(t, l, map[string]string{
+		"fluentd.tag": "app.{{.Container.Config.Labels.team}}",
+		"fluentd.ack": "true",
+	})
+	now := time.Unix(1500000000, 123)
+	adapter.flush([]*router.Message{
+		{Container: container, Source: "stdout", Data: "hello", Time: now, Fields: map[string]interface{}{"level": "info", "count": float64(2)}},
+		{Container: container, Source: "stderr", Data: "failed", Time: now},
+	})
+
+	msg := <-received
+	if msg[0] != "app.web" {
+		t.Errorf("expected tag app.web got %v", msg[0])
+	}
+	entries := msg[1].([]interface{})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries got %d", len(entries))
+	}
+	entry := entries[0].([]interface{})
+	if !entry[0].(time.Time).Equal(now) {
+		t.Errorf("expected time %v got %v", now, entry[0])
+	}
+	expected := map[string]interface{}{
+		"log":            "hello",
+		"source":         "stdout",
+		"container_id":   "8dfafdbc3a40",
+		"container_name": "/app",
+		"level":          "info",
+		"count":          int64(2),
+	}
+	if !reflect.DeepEqual(entry[1], expected) {
+		t.Errorf("expected record %v got %v", expected, entry[1])
+	}
+	option := msg[2].(map[string]interface{})
+	if option["size"] != int64(2) || option["chunk"] == nil {
+		t.Errorf("unexpected option %v", option)
+	}
+}
+
+func TestFluentdPackedForward(t *testing.T) {
+	received := make(chan []interface{}, 2)
+	l := startServer(t, true, received)
+	defer l.Close()
+	adapter := newTestAdapter(t, l, map[string]string{"fluentd.mode": "packed"})
+	other := &docker.Container{ID: "3b6ba57db54a", Name: "/db"}
+	adapter.flush([]*router.Message{
+		{Container: container, Data: "one", Time: time.Now()},
+		{Container: other, Data: "two", Time: time.Now()},
+		{Container: container, Data: "three", Time: time.Now()},
+	})
+
+	for _, expected := range []struct {
+		tag  string
+		logs []string
+	}{{"docker.app", []string{"one", "three"}}, {"docker.db", []string{"two"}}} {
+		msg := <-received
+		if msg[0] != expected.tag {
+			t.Errorf("expected tag %s got %v", expected.tag, msg[0])
+		}
+		r := bufio.NewReader(bytes.NewReader(msg[1].([]byte)))
+		for _, log := range expected.logs {
+			entry := decode(t, r).([]interface{})
+			if record := entry[1].(map[string]interface{}); record["log"] != log {
+				t.Errorf("expected log %s got %v", log, record["log"])
+			}
+		}
+		if _, err := r.Peek(1); err != io.EOF {
+			t.Errorf("expected %d entries for tag %s", len(expected.logs), expected.tag)
+		}
+	}
+}
+
+func TestFluentdAckTimeout(t *testing.T) {
+	received := make(chan []interface{}, 1)
+	l := startServer(t, false, received)
+	defer l.Close()
+	adapter := newTestAdapter(t, l, map[string]string{"fluentd.ack": "true", "fluentd.ack_timeout": "10ms"})
+	err := adapter.send("docker.app", []*router.Message{{Container: container, Data: "one", Time: time.Now()}})
+	if err == nil {
+		t.Error("expected error without ack")
+	}
+	if adapter.conn != nil {
+		t.Error("expected connection to be closed for a retry")
+	}
+}
+
+func TestFluentdBadOptions(t *testing.T) {
+	for _, opts := range []map[string]string{
+		{"fluentd.mode": "compressed"},
+		{"fluentd.tag": "{{"},
+		{"fluentd.ack_timeout": "never"},
+	} {
+		route := &router.Route{Adapter: "fluentd", Address: "127.0.0.1:24224", Options: opts}
+		if _, err := NewFluentdAdapter(route); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package fluentd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// The MessagePack encoding of the values of Fluent Forward messages:
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+
+func appendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, s...)
+}
+
+func appendBinary(b []byte, v []byte) []byte {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xc5, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xc6, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, v...)
+}
+
+func appendInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n < 128:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(n))
+	default:
+		b = append(b, 0xd3)
+		return appendUint64(b, uint64(n))
+	}
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
+
+func appendFloat(b []byte, f float64) []byte {
+	b = append(b, 0xcb)
+	return appendUint64(b, math.Float64bits(f))
+}
+
+// appendEventTime appends a time as the EventTime extension type of the
+// Forward protocol, with nanosecond precision
+func appendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = appendUint32(b, uint32(t.Unix()))
+	return appendUint32(b, uint32(t.Nanosecond()))
+}
+
+// appendValue appends the values found in records, like those parsed from
+// JSON messages. Other values are appended as their string representation.
+func appendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case string:
+		return appendString(b, v)
+	case int:
+		return appendInt(b, int64(v))
+	case int64:
+		return appendInt(b, v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return appendInt(b, int64(v))
+		}
+		return appendFloat(b, v)
+	case []interface{}:
+		b = appendArrayHeader(b, len(v))
+		for _, e := range v {
+			b = appendValue(b, e)
+		}
+		return b
+	case map[string]interface{}:
+		return appendMap(b, v)
+	case map[string]string:
+		b = appendMapHeader(b, len(v))
+		for _, key := range sortedKeys(v) {
+			b = appendString(b, key)
+			b = appendString(b, v[key])
+		}
+		return b
+	default:
+		return appendString(b, fmt.Sprint(v))
+	}
+}
+
+func appendMap(b []byte, m map[string]interface{}) []byte {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	b = appendMapHeader(b, len(m))
+	for _, key := range keys {
+		b = appendString(b, key)
+		b = appendValue(b, m[key])
+	}
+	return b
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readStringMap reads a map of strings, like the ack responses of Fluentd
+func readStringMap(r io.Reader) (map[string]string, error) {
+	n, err := readHeader(r, 0x80, 0xde, 0xdf)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func readString(r io.Reader) (string, error) {
+	n, err := readHeader(r, 0xa0, 0xd9, 0xda, 0xdb)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+// readHeader reads the length of a map or string, given the fix type prefix
+// and the types with 8, 16 or 32 bit lengths it may be encoded with.
+// Maps have no 8 bit type, so they are given only 16 and 32 bit types.
+func readHeader(r io.Reader, fix byte, types ...byte) (int, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return 0, err
+	}
+	fixMask := byte(0xe0)
+	if fix == 0x80 {
+		fixMask = 0xf0
+	}
+	if b[0]&fixMask == fix {
+		return int(b[0] &^ fixMask), nil
+	}
+	sizes := []int{1, 2, 4}
+	if len(types) == 2 {
+		sizes = sizes[1:]
+	}
+	for i, t := range types {
+		if b[0] != t {
+			continue
+		}
+		if _, err := io.ReadFull(r, b[:sizes[i]]); err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, c := range b[:sizes[i]] {
+			n = n<<8 | int(c)
+		}
+		return n, nil
+	}
+	return 0, errors.New("unexpected msgpack type " + fmt.Sprintf("0x%x", b[0]))
+}
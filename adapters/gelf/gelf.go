@@ -0,0 +1,298 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	// Version is the GELF specification version of the messages
+	Version = "1.1"
+
+	// chunks are prefixed with two magic bytes, an 8 byte message id,
+	// a sequence number and the sequence count
+	chunkHeaderSize = 12
+	maxChunks       = 128
+
+	defaultChunkSize = 1420
+
+	// syslog severities of the GELF level field
+	levelError = 3
+	levelInfo  = 6
+)
+
+var (
+	hostname string
+
+	chunkMagic = []byte{0x1e, 0x0f}
+
+	// additional field names must match ^[\w\.\-]*$
+	badFieldChars = regexp.MustCompile(`[^\w\.\-]`)
+)
+
+func init() {
+	hostname = getHostname()
+	router.AdapterFactories.Register(NewGelfAdapter, "gelf")
+}
+
+func getHostname() string {
+	content, err := ioutil.ReadFile("/etc/host_hostname")
+	if err == nil && len(content) > 0 {
+		return strings.TrimRight(string(content), "\r\n")
+	}
+	name, _ := os.Hostname()
+	return cfg.GetEnvDefault("GELF_HOSTNAME", name)
+}
+
+// NewGelfAdapter returns a configured gelf.Adapter
+func NewGelfAdapter(route *router.Route) (router.LogAdapter, error) {
+	transport, found := router.AdapterTransports.Lookup(route.AdapterTransport("udp"))
+	if !found {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	conn, err := transport.Dial(route.Address, route.Options)
+	if err != nil {
+		return nil, err
+	}
+	_, isUDP := conn.(*net.UDPConn)
+
+	compression := route.Options["gelf.compression"]
+	switch compression {
+	case "":
+		if isUDP {
+			compression = "gzip"
+		} else {
+			compression = "none"
+		}
+	case "gzip", "zlib", "none":
+		// GELF over TCP is delimited by null bytes, so it can't be compressed
+		if !isUDP && compression != "none" {
+			return nil, errors.New("gelf: compression is only supported over udp")
+		}
+	default:
+		return nil, errors.New("bad gelf.compression: " + compression)
+	}
+
+	chunkSize := defaultChunkSize
+	if s := route.Options["gelf.chunk_size"]; s != "" {
+		if chunkSize, err = strconv.Atoi(s); err != nil || chunkSize <= chunkHeaderSize {
+			return nil, errors.New("bad gelf.chunk_size: " + s)
+		}
+	}
+
+	var labels []string
+	if route.Options["gelf.labels"] != "" {
+		labels = strings.Split(route.Options["gelf.labels"], ",")
+	}
+
+	return &Adapter{
+		route:       route,
+		conn:        conn,
+		isUDP:       isUDP,
+		transport:   transport,
+		compression: compression,
+		chunkSize:   chunkSize,
+		labels:      labels,
+	}, nil
+}
+
+// Adapter streams log output to a connection in the GELF format
+type Adapter struct {
+	conn        net.Conn
+	isUDP       bool
+	route       *router.Route
+	transport   router.AdapterTransport
+	compression string
+	chunkSize   int
+	labels      []string
+}
+
+// Stream sends log data to a connection
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	for message := range logstream {
+		buf, err := json.Marshal(NewMessage(message, a.labels))
+		if err != nil {
+			log.Println("gelf:", err)
+			continue
+		}
+		if a.isUDP {
+			err = a.writeUDP(buf)
+		} else {
+			err = a.writeTCP(append(buf, 0))
+		}
+		if err != nil {
+			log.Println("gelf:", err)
+			a.route.CountWriteError()
+			continue
+		}
+		a.route.MarkWritten(message)
+	}
+}
+
+func (a *Adapter) writeUDP(buf []byte) error {
+	buf, err := compress(buf, a.compression)
+	if err != nil {
+		return err
+	}
+	chunks, err := chunk(buf, a.chunkSize)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := a.conn.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Adapter) writeTCP(buf []byte) error {
+	_, err := a.conn.Write(buf)
+	if err == nil {
+		return nil
+	}
+	log.Println("gelf: reconnecting after:", err)
+	conn, dialErr := a.transport.Dial(a.route.Address, a.route.Options)
+	if dialErr != nil {
+		return dialErr
+	}
+	a.conn.Close()
+	a.conn = conn
+	a.route.CountReconnect()
+	_, err = a.conn.Write(buf)
+	return err
+}
+
+// compress compresses a GELF message for UDP with gzip or zlib
+func compress(buf []byte, compression string) ([]byte, error) {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "zlib":
+		w = zlib.NewWriter(&b)
+	default:
+		return buf, nil
+	}
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// chunk splits a GELF message into UDP datagrams of at most size bytes
+func chunk(buf []byte, size int) ([][]byte, error) {
+	if len(buf) <= size {
+		return [][]byte{buf}, nil
+	}
+	payload := size - chunkHeaderSize
+	count := (len(buf) + payload - 1) / payload
+	if count > maxChunks {
+		return nil, errors.New("message too large: " + strconv.Itoa(len(buf)) + " bytes")
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * payload
+		if end > len(buf) {
+			end = len(buf)
+		}
+		c := make([]byte, 0, chunkHeaderSize+end-i*payload)
+		c = append(c, chunkMagic...)
+		c = append(c, id...)
+		c = append(c, byte(i), byte(count))
+		chunks = append(chunks, append(c, buf[i*payload:end]...))
+	}
+	return chunks, nil
+}
+
+// Message is a GELF message
+type Message map[string]interface{}
+
+// NewMessage maps a log message and the metadata of its container to GELF
+// fields. The fields parsed from the message and the given container labels
+// are added as additional fields, unless they collide with the fields
+// logspout sets itself.
+func NewMessage(m *router.Message, labels []string) Message {
+	level := levelInfo
+	if m.Source == "stderr" {
+		level = levelError
+	}
+	msg := Message{}
+	for key, value := range m.Fields {
+		msg.setField(key, value)
+	}
+	c := m.Container
+	if c != nil && c.Config != nil {
+		for _, label := range labels {
+			if value, ok := c.Config.Labels[label]; ok {
+				msg.setField(label, value)
+			}
+		}
+	}
+	msg["version"] = Version
+	msg["host"] = hostname
+	msg["short_message"] = m.Data
+	msg["timestamp"] = float64(m.Time.UnixNano()/int64(1e6)) / 1e3
+	msg["level"] = level
+	msg["_source"] = m.Source
+	if c != nil {
+		msg["_container_id"] = c.ID
+		msg["_container_name"] = strings.TrimPrefix(c.Name, "/")
+		msg["_image_id"] = c.Image
+		if !c.Created.IsZero() {
+			msg["_created"] = c.Created
+		}
+		if c.Config != nil {
+			msg["_image_name"] = c.Config.Image
+			msg["_container_hostname"] = c.Config.Hostname
+			if len(c.Config.Cmd) > 0 {
+				msg["_command"] = strings.Join(c.Config.Cmd, " ")
+			}
+		}
+	}
+	if msg["short_message"] == "" {
+		// short_message is mandatory and must not be empty
+		msg["short_message"] = " "
+	}
+	return msg
+}
+
+// setField sets an additional field, renamed to a valid GELF field name.
+// Values other than strings and numbers are encoded to JSON strings.
+func (msg Message) setField(key string, value interface{}) {
+	key = badFieldChars.ReplaceAllString(key, "_")
+	if key == "" || key == "id" {
+		// _id is reserved
+		key += "_"
+	}
+	switch value.(type) {
+	case string, float64, int:
+	default:
+		b, _ := json.Marshal(value)
+		value = string(b)
+	}
+	msg["_"+key] = value
+}
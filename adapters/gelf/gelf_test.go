@@ -0,0 +1,192 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	_ "github.com/gliderlabs/logspout/transports/tcp"
+	_ "github.com/gliderlabs/logspout/transports/udp"
+)
+
+var container = &docker.Container{
+	ID:    "8dfafdbc3a40",
+	Name:  "/app",
+	Image: "sha256:8f0a3b",
+	Config: &docker.Config{
+		Hostname: "8dfafdbc3a40",
+		Image:    "nginx:1.21",
+		Cmd:      []string{"nginx", "-g", "daemon off;"},
+		Labels:   map[string]string{"com.example.team": "web", "secret": "x"},
+	},
+}
+
+func TestGelfNewMessage(t *testing.T) {
+	msg := NewMessage(&router.Message{
+		Container: container,
+		Source:    "stderr",
+		Data:      "failed",
+		Time:      time.Unix(1500000000, 123456789),
+		Fields:    map[string]interface{}{"id": "1", "user name": "bob", "tags": []interface{}{"a"}, "source": "app", "container_id": "x"},
+	}, []string{"com.example.team"})
+
+	for key, expected := range map[string]interface{}{
+		"version":           "1.1",
+		"short_message":     "failed",
+		"timestamp":         1500000000.123,
+		"level":             levelError,
+		"_source":           "stderr",
+		"_container_id":     "8dfafdbc3a40",
+		"_container_name":   "app",
+		"_image_name":       "nginx:1.21",
+		"_image_id":         "sha256:8f0a3b",
+		"_command":          "nginx -g daemon off;",
+		"_com.example.team": "web",
+		"_id_":              "1",
+		"_user_name":        "bob",
+		"_tags":             `["a"]`,
+	} {
+		if msg[key] != expected {
+			t.Errorf("expected %s to be %v got %v", key, expected, msg[key])
+		}
+	}
+	if _, ok := msg["_secret"]; ok {
+		t.Error("expected unselected labels to be left out")
+	}
+}
+
+func TestGelfChunk(t *testing.T) {
+	buf := bytes.Repeat([]byte("0123456789"), 100)
+	if chunks, _ := chunk(buf, 2000); len(chunks) != 1 || !bytes.Equal(chunks[0], buf) {
+		t.Error("expected small message not to be chunked")
+	}
+	chunks, err := chunk(buf, 112)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 10 {
+		t.Fatalf("expected 10 chunks got %d", len(chunks))
+	}
+	var joined []byte
+	for i, c := range chunks {
+		if len(c) > 112 || c[0] != 0x1e || c[1] != 0x0f || c[10] != byte(i) || c[11] != 10 {
+			t.Errorf("bad header for chunk %d: %v", i, c[:chunkHeaderSize])
+		}
+		if !bytes.Equal(c[2:10], chunks[0][2:10]) {
+			t.Errorf("expected chunk %d to have the same message id", i)
+		}
+		joined = append(joined, c[chunkHeaderSize:]...)
+	}
+	if !bytes.Equal(joined, buf) {
+		t.Error("expected chunks to join into the message")
+	}
+	if _, err := chunk(make([]byte, 129*100), 112); err == nil {
+		t.Error("expected error for a message of more than 128 chunks")
+	}
+}
+
+func TestGelfUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	route := &router.Route{Adapter: "gelf", Address: conn.LocalAddr().String()}
+	adapter, err := NewGelfAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan *router.Message, 1)
+	stream <- &router.Message{Container: container, Source: "stdout", Data: "hello", Time: time.Now()}
+	close(stream)
+	adapter.Stream(stream)
+
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(buf[:n]))
+	if err != nil {
+		t.Fatal("expected gzip compressed message:", err)
+	}
+	var msg map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["short_message"] != "hello" || msg["level"] != float64(levelInfo) {
+		t.Errorf("unexpected message %v", msg)
+	}
+}
+
+func TestGelfTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan []byte)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b, _ := ioutil.ReadAll(c)
+		received <- b
+	}()
+
+	route := &router.Route{Adapter: "gelf+tcp", Address: l.Addr().String()}
+	adapter, err := NewGelfAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan *router.Message, 2)
+	stream <- &router.Message{Container: container, Source: "stdout", Data: "one", Time: time.Now()}
+	stream <- &router.Message{Container: container, Source: "stdout", Data: "two", Time: time.Now()}
+	close(stream)
+	adapter.Stream(stream)
+	adapter.(*Adapter).conn.Close()
+
+	messages := strings.Split(strings.TrimSuffix(string(<-received), "\x00"), "\x00")
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 null delimited messages got %q", messages)
+	}
+	for i, data := range []string{"one", "two"} {
+		var msg map[string]interface{}
+		if err := json.Unmarshal([]byte(messages[i]), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg["short_message"] != data {
+			t.Errorf("expected %s got %v", data, msg["short_message"])
+		}
+	}
+}
+
+func TestGelfBadOptions(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, opts := range []map[string]string{
+		{"gelf.compression": "lz4"},
+		{"gelf.chunk_size": "8"},
+	} {
+		route := &router.Route{Adapter: "gelf", Address: conn.LocalAddr().String(), Options: opts}
+		if _, err := NewGelfAdapter(route); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
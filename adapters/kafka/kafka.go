@@ -0,0 +1,290 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	defaultTopic         = "logspout"
+	defaultVersion       = "1.0.0"
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+)
+
+var (
+	hostname string
+
+	compressionCodecs = map[string]sarama.CompressionCodec{
+		"none":   sarama.CompressionNone,
+		"gzip":   sarama.CompressionGZIP,
+		"snappy": sarama.CompressionSnappy,
+		"lz4":    sarama.CompressionLZ4,
+		"zstd":   sarama.CompressionZSTD,
+	}
+
+	requiredAcks = map[string]sarama.RequiredAcks{
+		"0":   sarama.NoResponse,
+		"1":   sarama.WaitForLocal,
+		"all": sarama.WaitForAll,
+	}
+)
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewKafkaAdapter, "kafka")
+	router.SecretOptions("kafka.sasl.password")
+}
+
+// NewKafkaAdapter returns a configured kafka.Adapter
+func NewKafkaAdapter(route *router.Route) (router.LogAdapter, error) {
+	a, err := newAdapter(route)
+	if err != nil {
+		return nil, err
+	}
+	if a.producer, err = sarama.NewAsyncProducer(a.brokers, a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newAdapter returns an adapter configured by the options of a route, without its producer
+func newAdapter(route *router.Route) (*Adapter, error) {
+	transport, found := router.AdapterTransports.Lookup(route.AdapterTransport("tcp"))
+	if !found {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:   route,
+		brokers: strings.Split(route.Address, ","),
+		key:     route.Options["kafka.key"],
+	}
+	switch a.key {
+	case "":
+		a.key = "id"
+	case "id", "name", "none":
+	default:
+		return nil, errors.New("bad kafka.key: " + a.key)
+	}
+	topic := route.Options["kafka.topic"]
+	if topic == "" {
+		topic = defaultTopic
+	}
+	var err error
+	if a.topic, err = template.New("topic").Parse(topic); err != nil {
+		return nil, errors.New("bad kafka.topic: " + err.Error())
+	}
+	if tmplStr := route.Options["kafka.template"]; tmplStr != "" {
+		if a.tmpl, err = template.New("kafka").Parse(tmplStr); err != nil {
+			return nil, errors.New("bad kafka.template: " + err.Error())
+		}
+	}
+	if a.config, err = newConfig(route, transport); err != nil {
+		return nil, err
+	}
+	if a.key == "none" {
+		a.config.Producer.Partitioner = sarama.NewRandomPartitioner
+	}
+	return a, nil
+}
+
+// newConfig returns the producer config of the options of a route. Brokers are
+// dialed with the transport of the route, so kafka+tls routes use the TLS
+// settings of the tls transport.
+func newConfig(route *router.Route, transport router.AdapterTransport) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "logspout"
+	config.Net.Proxy.Enable = true
+	config.Net.Proxy.Dialer = &transportDialer{transport, route.Options}
+	config.Producer.Return.Errors = true
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+
+	var ok bool
+	compression := route.Options["kafka.compression"]
+	if compression == "" {
+		compression = "none"
+	}
+	if config.Producer.Compression, ok = compressionCodecs[compression]; !ok {
+		return nil, errors.New("bad kafka.compression: " + compression)
+	}
+	acks := route.Options["kafka.acks"]
+	if acks == "" {
+		acks = "1"
+	}
+	if config.Producer.RequiredAcks, ok = requiredAcks[acks]; !ok {
+		return nil, errors.New("bad kafka.acks: " + acks)
+	}
+	version := route.Options["kafka.version"]
+	if version == "" {
+		version = defaultVersion
+		if config.Producer.Compression == sarama.CompressionZSTD {
+			// zstd was added in Kafka 2.1.0
+			version = "2.1.0"
+		}
+	}
+	var err error
+	if config.Version, err = sarama.ParseKafkaVersion(version); err != nil {
+		return nil, errors.New("bad kafka.version: " + version)
+	}
+
+	batchSize, batchInterval, err := route.BatchOptions(defaultBatchSize, defaultBatchInterval)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Flush.Messages = batchSize
+	config.Producer.Flush.Frequency = batchInterval
+	if config.Producer.Retry.Max, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	config.Producer.Retry.Backoff = router.RetryBackoff
+
+	if err := setSASL(config, route.Options); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// setSASL enables SASL authentication when a kafka.sasl.mechanism is set
+func setSASL(config *sarama.Config, options map[string]string) error {
+	mechanism := options["kafka.sasl.mechanism"]
+	if mechanism == "" {
+		return nil
+	}
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = options["kafka.sasl.username"]
+	config.Net.SASL.Password = options["kafka.sasl.password"]
+	if config.Net.SASL.User == "" {
+		config.Net.SASL.User = cfg.GetEnvDefault("KAFKA_SASL_USERNAME", "")
+		config.Net.SASL.Password = cfg.GetEnvDefault("KAFKA_SASL_PASSWORD", "")
+	}
+	switch strings.ToUpper(mechanism) {
+	case sarama.SASLTypePlaintext:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMClient(sha256Hash)
+	case sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMClient(sha512Hash)
+	default:
+		return errors.New("bad kafka.sasl.mechanism: " + mechanism)
+	}
+	return nil
+}
+
+// transportDialer dials brokers with an adapter transport
+type transportDialer struct {
+	transport router.AdapterTransport
+	options   map[string]string
+}
+
+func (d *transportDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.transport.Dial(addr, d.options)
+}
+
+// Adapter produces log messages to Kafka topics
+type Adapter struct {
+	route    *router.Route
+	brokers  []string
+	config   *sarama.Config
+	producer sarama.AsyncProducer
+	topic    *template.Template
+	tmpl     *template.Template
+	key      string
+}
+
+// Stream produces log messages, keyed by their container so the messages of
+// a container stay in order in a single partition
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for err := range a.producer.Errors() {
+			log.Println("kafka: dropping message:", err)
+			a.route.CountWriteError()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for msg := range a.producer.Successes() {
+			a.route.MarkWritten(msg.Metadata.(*router.Message))
+		}
+	}()
+	defer wg.Wait()
+	defer a.producer.AsyncClose()
+	for message := range logstream {
+		msg, err := a.newMessage(message)
+		if err != nil {
+			log.Println("kafka:", err)
+			continue
+		}
+		a.producer.Input() <- msg
+	}
+}
+
+func (a *Adapter) newMessage(message *router.Message) (*sarama.ProducerMessage, error) {
+	m := &Message{message}
+	var topic bytes.Buffer
+	if err := a.topic.Execute(&topic, m); err != nil {
+		return nil, err
+	}
+	var value []byte
+	if a.tmpl != nil {
+		var buf bytes.Buffer
+		if err := a.tmpl.Execute(&buf, m); err != nil {
+			return nil, err
+		}
+		value = buf.Bytes()
+	} else {
+		var err error
+		if value, err = json.Marshal(router.NewRecord(message, hostname)); err != nil {
+			return nil, err
+		}
+	}
+	msg := &sarama.ProducerMessage{
+		Topic:     topic.String(),
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: message.Time,
+		Metadata:  message,
+	}
+	if message.Container != nil {
+		switch a.key {
+		case "id":
+			msg.Key = sarama.StringEncoder(message.Container.ID)
+		case "name":
+			msg.Key = sarama.StringEncoder(m.ContainerName())
+		}
+	}
+	return msg, nil
+}
+
+// Message extends router.Message for topic and message templates
+type Message struct {
+	*router.Message
+}
+
+// ContainerName returns the message's container name
+func (m *Message) ContainerName() string {
+	if m.Container == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Container.Name, "/")
+}
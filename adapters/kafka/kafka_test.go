@@ -0,0 +1,186 @@
+package kafka
+
+import (
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+	_ "github.com/gliderlabs/logspout/transports/tcp"
+)
+
+var container = &docker.Container{
+	ID:     "8dfafdbc3a40",
+	Name:   "/web",
+	Config: &docker.Config{Image: "nginx:1.21", Labels: map[string]string{"team": "shop"}},
+}
+
+// countingTransport dials TCP, counting its connections
+type countingTransport struct {
+	dials int32
+}
+
+func (t *countingTransport) Dial(addr string, options map[string]string) (net.Conn, error) {
+	atomic.AddInt32(&t.dials, 1)
+	return net.Dial("tcp", addr)
+}
+
+func TestKafkaMessages(t *testing.T) {
+	route := &router.Route{Adapter: "kafka", Address: "localhost:9092", Options: map[string]string{
+		"kafka.topic": "logs-{{index .Container.Config.Labels \"team\"}}",
+		"kafka.key":   "name",
+	}}
+	a, err := newAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0).UTC()
+	message := &router.Message{Container: container, Source: "stdout", Data: "hello", Time: now}
+	msg, err := a.newMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Topic != "logs-shop" {
+		t.Errorf("expected topic logs-shop got %s", msg.Topic)
+	}
+	if key, _ := msg.Key.Encode(); string(key) != "web" {
+		t.Errorf("expected key web got %s", key)
+	}
+	if !msg.Timestamp.Equal(now) {
+		t.Errorf("expected timestamp %v got %v", now, msg.Timestamp)
+	}
+	value, _ := msg.Value.Encode()
+	var record router.Record
+	if err := json.Unmarshal(value, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Message != "hello" || record.Source != "stdout" || record.Container.Image != "nginx:1.21" {
+		t.Errorf("unexpected record %s", value)
+	}
+
+	producer := mocks.NewAsyncProducer(t, a.config)
+	a.producer = producer
+	producer.ExpectInputAndSucceed()
+	routertest.Stream(a, message)
+	if route.Health().LastWrite == nil {
+		t.Error("expected the produced message to mark the route written")
+	}
+}
+
+func TestKafkaTemplate(t *testing.T) {
+	route := &router.Route{Adapter: "kafka", Address: "localhost:9092", Options: map[string]string{
+		"kafka.template": "{{.ContainerName}}: {{.Data}}",
+	}}
+	a, err := newAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := a.newMessage(&router.Message{Container: container, Data: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := msg.Value.Encode(); string(value) != "web: hello" {
+		t.Errorf("unexpected value %s", value)
+	}
+	if key, _ := msg.Key.Encode(); string(key) != container.ID {
+		t.Errorf("expected the container id as key, got %s", key)
+	}
+	if msg.Topic != defaultTopic {
+		t.Errorf("expected topic %s got %s", defaultTopic, msg.Topic)
+	}
+}
+
+func TestKafkaConfig(t *testing.T) {
+	route := &router.Route{Adapter: "kafka", Address: "b1:9092,b2:9092", Options: map[string]string{
+		"kafka.compression":    "zstd",
+		"kafka.acks":           "all",
+		"kafka.sasl.mechanism": "scram-sha-512",
+		"kafka.sasl.username":  "logspout",
+		"kafka.sasl.password":  "secret",
+		"batch.size":           "500",
+		"retry.count":          "3",
+	}}
+	a, err := newAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := a.config
+	if len(a.brokers) != 2 || a.brokers[1] != "b2:9092" {
+		t.Errorf("unexpected brokers %v", a.brokers)
+	}
+	if config.Producer.Compression != sarama.CompressionZSTD || !config.Version.IsAtLeast(sarama.V2_1_0_0) {
+		t.Errorf("expected zstd with Kafka 2.1.0, got %v with %v", config.Producer.Compression, config.Version)
+	}
+	if config.Producer.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("unexpected acks %v", config.Producer.RequiredAcks)
+	}
+	if config.Producer.Flush.Messages != 500 || config.Producer.Retry.Max != 3 {
+		t.Errorf("unexpected batch size %d and retries %d", config.Producer.Flush.Messages, config.Producer.Retry.Max)
+	}
+	if !config.Net.SASL.Enable || config.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 || config.Net.SASL.User != "logspout" {
+		t.Errorf("unexpected SASL config %+v", config.Net.SASL)
+	}
+	if err := config.Net.SASL.SCRAMClientGeneratorFunc().Begin("logspout", "secret", ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKafkaBroker(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("logspout", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+	transport := new(countingTransport)
+	router.AdapterTransports.Register(transport, "counting")
+
+	route := &router.Route{Adapter: "kafka+counting", Address: broker.Addr(), Options: map[string]string{"batch.interval": "10ms"}}
+	adapter, err := NewKafkaAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routertest.Stream(adapter,
+		&router.Message{Container: container, Data: "one", Time: time.Now()},
+		&router.Message{Container: container, Data: "two", Time: time.Now()},
+	)
+
+	produced := 0
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+	if produced == 0 {
+		t.Error("expected messages to be produced")
+	}
+	if atomic.LoadInt32(&transport.dials) == 0 {
+		t.Error("expected brokers to be dialed with the route transport")
+	}
+}
+
+func TestKafkaBadOptions(t *testing.T) {
+	for _, opts := range []map[string]string{
+		{"kafka.key": "image"},
+		{"kafka.topic": "{{"},
+		{"kafka.compression": "brotli"},
+		{"kafka.acks": "2"},
+		{"kafka.version": "latest"},
+		{"kafka.sasl.mechanism": "GSSAPI"},
+		{"batch.size": "0"},
+	} {
+		route := &router.Route{Adapter: "kafka", Address: "localhost:9092", Options: opts}
+		if _, err := newAdapter(route); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
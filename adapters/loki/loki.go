@@ -0,0 +1,309 @@
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	pushPath = "/loki/api/v1/push"
+
+	defaultLabels        = "container_name,source"
+	defaultBatchSize     = 1000
+	defaultBatchInterval = time.Second
+	requestTimeout       = 30 * time.Second
+)
+
+var (
+	hostname string
+
+	// label names must match ^[a-zA-Z_][a-zA-Z0-9_]*$
+	badLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewLokiAdapter, "loki")
+	router.SecretOptions("loki.password")
+}
+
+// labelFuncs are the attributes of messages available as stream labels,
+// besides container labels selected with label.<key>
+var labelFuncs = map[string]func(m *router.Message) string{
+	"container_name": func(m *router.Message) string {
+		if m.Container == nil {
+			return ""
+		}
+		return strings.TrimPrefix(m.Container.Name, "/")
+	},
+	"container_id": func(m *router.Message) string {
+		if m.Container == nil {
+			return ""
+		}
+		return m.Container.ID
+	},
+	"image": func(m *router.Message) string {
+		if m.Container == nil || m.Container.Config == nil {
+			return ""
+		}
+		return m.Container.Config.Image
+	},
+	"compose_project": containerLabel("com.docker.compose.project"),
+	"compose_service": containerLabel("com.docker.compose.service"),
+	"swarm_service":   containerLabel("com.docker.swarm.service.name"),
+	"source": func(m *router.Message) string {
+		return m.Source
+	},
+	"host": func(m *router.Message) string {
+		return hostname
+	},
+}
+
+func containerLabel(key string) func(m *router.Message) string {
+	return func(m *router.Message) string {
+		if m.Container == nil || m.Container.Config == nil {
+			return ""
+		}
+		return m.Container.Config.Labels[key]
+	}
+}
+
+// streamLabel is a label of the streams messages are grouped in
+type streamLabel struct {
+	name  string
+	value func(m *router.Message) string
+}
+
+// parseLabels returns the stream labels named in a loki.labels option
+func parseLabels(s string) ([]streamLabel, error) {
+	var labels []streamLabel
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if key := strings.TrimPrefix(name, "label."); key != name && key != "" {
+			labels = append(labels, streamLabel{labelName(key), containerLabel(key)})
+			continue
+		}
+		value, ok := labelFuncs[name]
+		if !ok {
+			return nil, errors.New("bad loki.labels: unknown label " + name)
+		}
+		labels = append(labels, streamLabel{name, value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels, nil
+}
+
+// labelName returns a valid Loki label name for a container label
+func labelName(key string) string {
+	name := badLabelChars.ReplaceAllString(key, "_")
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// NewLokiAdapter returns a configured loki.Adapter
+func NewLokiAdapter(route *router.Route) (router.LogAdapter, error) {
+	scheme := route.AdapterTransport("http")
+	if scheme != "http" && scheme != "https" {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:    route,
+		url:      scheme + "://" + strings.TrimSuffix(route.Address+route.Path, "/") + pushPath,
+		client:   &http.Client{Timeout: requestTimeout},
+		tenant:   route.Options["loki.tenant"],
+		username: route.Options["loki.username"],
+		password: route.Options["loki.password"],
+		encoding: route.Options["loki.encoding"],
+	}
+	if a.username == "" {
+		a.username = cfg.GetEnvDefault("LOKI_USERNAME", "")
+		a.password = cfg.GetEnvDefault("LOKI_PASSWORD", "")
+	}
+	switch a.encoding {
+	case "":
+		a.encoding = "protobuf"
+	case "protobuf", "json":
+	default:
+		return nil, errors.New("bad loki.encoding: " + a.encoding)
+	}
+	labels := route.Options["loki.labels"]
+	if labels == "" {
+		labels = defaultLabels
+	}
+	var err error
+	if a.labels, err = parseLabels(labels); err != nil {
+		return nil, err
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Adapter pushes log messages to Grafana Loki
+type Adapter struct {
+	route         *router.Route
+	url           string
+	client        *http.Client
+	tenant        string
+	username      string
+	password      string
+	encoding      string
+	labels        []streamLabel
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// Stream pushes batches of log messages to Loki
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	streams := a.streams(batch)
+	var body []byte
+	var err error
+	if a.encoding == "json" {
+		body, err = encodeJSON(streams)
+	} else {
+		body = snappy.Encode(nil, encodeProtobuf(streams))
+	}
+	if err != nil {
+		log.Println("loki:", err)
+		return
+	}
+	err = a.route.Retry(a.retries, func() error {
+		return a.push(body)
+	}, batch...)
+	if err != nil {
+		log.Printf("loki: dropping %d messages: %v", len(batch), err)
+		a.route.CountWriteError()
+	}
+}
+
+func (a *Adapter) push(body []byte) error {
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(body))
+	if err != nil {
+		return router.Permanent(err)
+	}
+	if a.encoding == "json" {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	if a.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", a.tenant)
+	}
+	if a.username != "" {
+		req.SetBasicAuth(a.username, a.password)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return router.CheckHTTPResponse(resp)
+}
+
+// Stream is a set of labels and the log entries pushed with them
+type Stream struct {
+	Labels  map[string]string
+	Entries []Entry
+}
+
+// Entry is a log line of a stream
+type Entry struct {
+	Time time.Time
+	Line string
+}
+
+// streams groups messages by their labels, with entries in time order since
+// Loki may reject entries older than the last one of their stream
+func (a *Adapter) streams(batch []*router.Message) []*Stream {
+	var streams []*Stream
+	byKey := make(map[string]*Stream)
+	for _, message := range batch {
+		labels := make(map[string]string, len(a.labels))
+		var key strings.Builder
+		for _, label := range a.labels {
+			if value := label.value(message); value != "" {
+				labels[label.name] = value
+				key.WriteString(label.name + "=" + strconv.Quote(value) + ",")
+			}
+		}
+		if len(labels) == 0 {
+			// Loki rejects streams without labels
+			labels["job"] = "logspout"
+		}
+		stream, ok := byKey[key.String()]
+		if !ok {
+			stream = &Stream{Labels: labels}
+			byKey[key.String()] = stream
+			streams = append(streams, stream)
+		}
+		stream.Entries = append(stream.Entries, Entry{message.Time, message.Data})
+	}
+	for _, stream := range streams {
+		entries := stream.Entries
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	}
+	return streams
+}
+
+// encodeJSON encodes streams for the JSON push API
+func encodeJSON(streams []*Stream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, stream := range streams {
+		s := jsonStream{Stream: stream.Labels}
+		for _, entry := range stream.Entries {
+			s.Values = append(s.Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), entry.Line})
+		}
+		req.Streams = append(req.Streams, s)
+	}
+	return json.Marshal(req)
+}
+
+// labelsString formats labels as a LogQL stream selector, like {source="stdout"}
+func labelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name + "=" + strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package loki
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/snappy"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+)
+
+var container = &docker.Container{
+	ID:   "8dfafdbc3a40",
+	Name: "/shop_web_1",
+	Config: &docker.Config{
+		Image: "nginx:1.21",
+		Labels: map[string]string{
+			"com.docker.compose.service": "web",
+			"com.example.team":           "shop",
+		},
+	},
+}
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+}
+
+func streamMessages(t *testing.T, srv *httptest.Server, options map[string]string, messages ...*router.Message) {
+	route := &router.Route{Adapter: "loki", Address: strings.TrimPrefix(srv.URL, "http://"), Options: options}
+	adapter, err := NewLokiAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routertest.Stream(adapter, messages...)
+}
+
+func TestLokiJSON(t *testing.T) {
+	requests := make(chan routertest.Request, 1)
+	srv := routertest.NewServer(requests, http.StatusTooManyRequests)
+	defer srv.Close()
+	now := time.Unix(1500000000, 0)
+	streamMessages(t, srv, map[string]string{
+		"loki.encoding": "json",
+		"loki.labels":   "compose_service,source,label.com.example.team",
+		"loki.tenant":   "team-a",
+	},
+		&router.Message{Container: container, Source: "stdout", Data: "second", Time: now.Add(time.Second)},
+		&router.Message{Container: container, Source: "stderr", Data: "error", Time: now},
+		&router.Message{Container: container, Source: "stdout", Data: "first", Time: now},
+	)
+	req := <-requests
+	if req.Path != pushPath {
+		t.Errorf("expected path %s got %s", pushPath, req.Path)
+	}
+	if req.Header.Get("X-Scope-OrgID") != "team-a" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(req.Body, &push); err != nil {
+		t.Fatal(err)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("expected 2 streams got %d", len(push.Streams))
+	}
+	expected := map[string]string{"compose_service": "web", "source": "stdout", "com_example_team": "shop"}
+	if !reflect.DeepEqual(push.Streams[0].Stream, expected) {
+		t.Errorf("expected labels %v got %v", expected, push.Streams[0].Stream)
+	}
+	values := [][2]string{{"1500000000000000000", "first"}, {"1500000001000000000", "second"}}
+	if !reflect.DeepEqual(push.Streams[0].Values, values) {
+		t.Errorf("expected values in time order %v got %v", values, push.Streams[0].Values)
+	}
+}
+
+// readField reads a protobuf field, returning its number, value and the rest of b
+func readField(t *testing.T, b []byte) (int, []byte, []byte) {
+	key, n := binary.Uvarint(b)
+	b = b[n:]
+	if key&7 == wireVarint {
+		_, n = binary.Uvarint(b)
+		return int(key >> 3), b[:n], b[n:]
+	}
+	length, n := binary.Uvarint(b)
+	b = b[n:]
+	if key&7 != wireBytes || int(length) > len(b) {
+		t.Fatalf("bad protobuf field %d", key)
+	}
+	return int(key >> 3), b[:length], b[length:]
+}
+
+func TestLokiProtobuf(t *testing.T) {
+	requests := make(chan routertest.Request, 1)
+	srv := routertest.NewServer(requests)
+	defer srv.Close()
+	streamMessages(t, srv, nil,
+		&router.Message{Container: container, Source: "stdout", Data: "hello", Time: time.Unix(1500000000, 5)},
+	)
+	req := <-requests
+	if req.Header.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected content type %s", req.Header.Get("Content-Type"))
+	}
+	body, err := snappy.Decode(nil, req.Body)
+	if err != nil {
+		t.Fatal("expected snappy compressed body:", err)
+	}
+	field, stream, rest := readField(t, body)
+	if field != 1 || len(rest) != 0 {
+		t.Fatal("expected a single stream")
+	}
+	field, labels, stream := readField(t, stream)
+	if field != 1 || string(labels) != `{container_name="shop_web_1", source="stdout"}` {
+		t.Errorf("unexpected labels %s", labels)
+	}
+	field, entry, _ := readField(t, stream)
+	if field != 2 {
+		t.Fatal("expected an entry")
+	}
+	_, ts, entry := readField(t, entry)
+	_, line, _ := readField(t, entry)
+	if string(line) != "hello" {
+		t.Errorf("expected line hello got %s", line)
+	}
+	_, seconds, ts := readField(t, ts)
+	_, nanos, _ := readField(t, ts)
+	if s, _ := binary.Uvarint(seconds); s != 1500000000 {
+		t.Errorf("expected seconds 1500000000 got %d", s)
+	}
+	if n, _ := binary.Uvarint(nanos); n != 5 {
+		t.Errorf("expected nanos 5 got %d", n)
+	}
+}
+
+func TestLokiBadOptions(t *testing.T) {
+	for _, tc := range []struct {
+		adapter string
+		options map[string]string
+	}{
+		{"loki+tcp", nil},
+		{"loki", map[string]string{"loki.encoding": "xml"}},
+		{"loki", map[string]string{"loki.labels": "container_name,unknown"}},
+		{"loki", map[string]string{"loki.labels": "label."}},
+	} {
+		route := &router.Route{Adapter: tc.adapter, Address: "localhost:3100", Options: tc.options}
+		if _, err := NewLokiAdapter(route); err == nil {
+			t.Errorf("expected error for %s with options %v", tc.adapter, tc.options)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package loki
+
+// encodeProtobuf encodes streams as a logproto.PushRequest:
+//
+//	message PushRequest { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+//	message Timestamp { int64 seconds = 1; int32 nanos = 2; }
+func encodeProtobuf(streams []*Stream) []byte {
+	var req []byte
+	for _, stream := range streams {
+		var s []byte
+		s = appendBytes(s, 1, []byte(labelsString(stream.Labels)))
+		for _, entry := range stream.Entries {
+			var ts []byte
+			if seconds := entry.Time.Unix(); seconds != 0 {
+				ts = appendVarint(ts, 1, uint64(seconds))
+			}
+			if nanos := entry.Time.Nanosecond(); nanos != 0 {
+				ts = appendVarint(ts, 2, uint64(nanos))
+			}
+			var e []byte
+			e = appendBytes(e, 1, ts)
+			e = appendBytes(e, 2, []byte(entry.Line))
+			s = appendBytes(s, 2, e)
+		}
+		req = appendBytes(req, 1, s)
+	}
+	return req
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field<<3|wireVarint))
+	return appendUvarint(b, v)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendUvarint(b, uint64(field<<3|wireBytes))
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	exporter "github.com/gliderlabs/logspout/metrics"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	defaultMaxSeries     = 10000
+	defaultExpire        = time.Hour
+
+	// maxPacketSize keeps statsd packets within the MTU of most networks
+	maxPacketSize = 1432
+)
+
+// defaultBuckets are the upper bounds of histogram buckets, as in the
+// Prometheus client libraries
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+func init() {
+	router.AdapterFactories.Register(NewMetricsAdapter, "metrics")
+}
+
+// NewMetricsAdapter returns a configured metrics.Adapter. Without transport,
+// it exports its metrics on the /metrics handler, otherwise it sends them to
+// statsd with the transport, like metrics+udp://statsd:8125
+func NewMetricsAdapter(route *router.Route) (router.LogAdapter, error) {
+	rules, err := parseRules(route.Options)
+	if err != nil {
+		return nil, err
+	}
+	a := &Adapter{
+		route:   route,
+		rules:   rules,
+		buckets: defaultBuckets,
+		series:  make(map[*rule]map[string]*series),
+	}
+	if buckets := route.Options["metrics.buckets"]; buckets != "" {
+		if a.buckets, err = parseBuckets(buckets); err != nil {
+			return nil, err
+		}
+	}
+	if route.AdapterTransport("") == "" {
+		if a.maxSeries, err = route.IntOption("metrics.max_series", defaultMaxSeries); err != nil {
+			return nil, err
+		}
+		if a.maxSeries == 0 {
+			return nil, errors.New("bad metrics.max_series: 0")
+		}
+		if a.expire, err = route.DurationOption("metrics.expire", defaultExpire); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	transport, found := router.AdapterTransports.Lookup(route.AdapterTransport("udp"))
+	if !found {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.conn, err = transport.Dial(route.Address, route.Options); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(s, ",") {
+		le, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || (len(buckets) > 0 && le <= buckets[len(buckets)-1]) {
+			return nil, errors.New("bad metrics.buckets: " + s)
+		}
+		buckets = append(buckets, le)
+	}
+	return buckets, nil
+}
+
+// Adapter counts the log messages matching its rules instead of forwarding
+// them
+type Adapter struct {
+	route         *router.Route
+	rules         []*rule
+	buckets       []float64
+	conn          net.Conn
+	batchSize     int
+	batchInterval time.Duration
+	maxSeries     int
+	expire        time.Duration
+
+	mu      sync.Mutex
+	series  map[*rule]map[string]*series
+	nseries int
+}
+
+// series is a counter or histogram with a set of label values
+type series struct {
+	labels  []string
+	sum     float64
+	count   uint64
+	buckets []uint64 // cumulative counts of each bucket
+	updated time.Time
+}
+
+// Stream counts log messages, sending the samples to statsd or keeping them
+// for the /metrics handler until logstream is closed
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	if a.conn != nil {
+		router.Batch(logstream, a.batchSize, a.batchInterval, a.send)
+		return
+	}
+	var names []string
+	for _, r := range a.rules {
+		names = append(names, r.names()...)
+	}
+	if err := exporter.Register(a, names...); err != nil {
+		log.Println("metrics: not exporting the metrics of route", a.route.ID+":", err)
+		a.route.CountWriteError()
+		for range logstream {
+		}
+		return
+	}
+	defer exporter.Unregister(a)
+	for message := range logstream {
+		a.observe(message)
+		a.route.MarkDelivered(message)
+	}
+}
+
+func (a *Adapter) observe(message *router.Message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, r := range a.rules {
+		labels, value, ok := r.match(message)
+		if !ok {
+			continue
+		}
+		key := strings.Join(labels, "\xff")
+		s, ok := a.series[r][key]
+		if !ok {
+			if a.nseries >= a.maxSeries {
+				a.evictOldest()
+			}
+			s = &series{labels: labels}
+			if r.histogram {
+				s.buckets = make([]uint64, len(a.buckets))
+			}
+			if a.series[r] == nil {
+				a.series[r] = make(map[string]*series)
+			}
+			a.series[r][key] = s
+			a.nseries++
+		}
+		s.updated = now
+		s.sum += value
+		s.count++
+		if r.histogram {
+			for i, le := range a.buckets {
+				if value <= le {
+					s.buckets[i]++
+				}
+			}
+		}
+	}
+}
+
+// evictOldest removes the series updated the longest ago, to keep at most
+// maxSeries of them
+func (a *Adapter) evictOldest() {
+	var oldest *series
+	var oldestRule *rule
+	var oldestKey string
+	for r, series := range a.series {
+		for key, s := range series {
+			if oldest == nil || s.updated.Before(oldest.updated) {
+				oldest, oldestRule, oldestKey = s, r, key
+			}
+		}
+	}
+	if oldest != nil {
+		delete(a.series[oldestRule], oldestKey)
+		a.nseries--
+	}
+}
+
+// expireSeries removes the series not updated for the expire option, like
+// those of removed containers
+func (a *Adapter) expireSeries(now time.Time) {
+	if a.expire == 0 {
+		return
+	}
+	for _, series := range a.series {
+		for key, s := range series {
+			if now.Sub(s.updated) > a.expire {
+				delete(series, key)
+				a.nseries--
+			}
+		}
+	}
+}
+
+// Collect writes the counters and histograms in the Prometheus text format
+func (a *Adapter) Collect(w *bufio.Writer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expireSeries(time.Now())
+	for _, r := range a.rules {
+		typ, option := "counter", counterPrefix
+		if r.histogram {
+			typ, option = "histogram", histogramPrefix
+		}
+		w.WriteString("# HELP " + r.name + " Log lines matching " + option + r.name + ".\n")
+		w.WriteString("# TYPE " + r.name + " " + typ + "\n")
+		keys := make([]string, 0, len(a.series[r]))
+		for key := range a.series[r] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := a.series[r][key]
+			if !r.histogram {
+				writeSample(w, r.name, s.labels, s.sum)
+				continue
+			}
+			bucket := append(s.labels[:len(s.labels):len(s.labels)], "le", "")
+			for i, le := range a.buckets {
+				bucket[len(bucket)-1] = formatFloat(le)
+				writeSample(w, r.name+"_bucket", bucket, float64(s.buckets[i]))
+			}
+			bucket[len(bucket)-1] = "+Inf"
+			writeSample(w, r.name+"_bucket", bucket, float64(s.count))
+			writeSample(w, r.name+"_sum", s.labels, s.sum)
+			writeSample(w, r.name+"_count", s.labels, float64(s.count))
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, value float64) {
+	w.WriteString(name + "{")
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(labels[i] + `="` + exporter.EscapeLabel(labels[i+1]) + `"`)
+	}
+	w.WriteString("} " + formatFloat(value) + "\n")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+
+// send sends the samples of a batch of messages to statsd, with labels as
+// DogStatsD tags, in packets of at most maxPacketSize bytes
+func (a *Adapter) send(messages []*router.Message) {
+	var packet bytes.Buffer
+	for _, message := range messages {
+		for _, r := range a.rules {
+			labels, value, ok := r.match(message)
+			if !ok {
+				continue
+			}
+			typ := "c"
+			if r.histogram {
+				typ = "ms"
+			}
+			tags := make([]string, 0, len(labels)/2)
+			for i := 0; i < len(labels); i += 2 {
+				tags = append(tags, labels[i]+":"+tagEscaper.Replace(labels[i+1]))
+			}
+			line := r.name + ":" + formatFloat(value) + "|" + typ + "|#" + strings.Join(tags, ",") + "\n"
+			if packet.Len() > 0 && packet.Len()+len(line) > maxPacketSize {
+				a.write(packet.Bytes())
+				packet.Reset()
+			}
+			packet.WriteString(line)
+		}
+	}
+	if packet.Len() > 0 {
+		a.write(packet.Bytes())
+	}
+	// samples aren't resent, so the messages are done with once sent
+	a.route.MarkDelivered(messages...)
+}
+
+func (a *Adapter) write(packet []byte) {
+	if _, err := a.conn.Write(packet); err != nil {
+		log.Printf("metrics: dropping %d samples: %v", bytes.Count(packet, []byte("\n")), err)
+		a.route.CountWriteError()
+		return
+	}
+	a.route.MarkWritten()
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	exporter "github.com/gliderlabs/logspout/metrics"
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+	_ "github.com/gliderlabs/logspout/transports/udp"
+)
+
+var (
+	web = &docker.Container{ID: "8dfafdbc3a40", Name: "/web"}
+	api = &docker.Container{ID: "d9e6a2fc1b74", Name: "/api"}
+
+	requests = `(?P<method>[A-Z]+) \S+ (?P<status>\d{3})`
+	duration = `took (?P<value>[0-9.]+)s`
+)
+
+func collect(a *Adapter) string {
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+	a.Collect(w)
+	w.Flush()
+	return b.String()
+}
+
+func TestCounter(t *testing.T) {
+	adapter, err := NewMetricsAdapter(&router.Route{Adapter: "metrics", Options: map[string]string{
+		"metrics.counter.http_requests_total": requests,
+		"metrics.counter.bytes_sent_total":    `sent (?P<value>\d+) bytes`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := adapter.(*Adapter)
+	for _, message := range []*router.Message{
+		{Container: web, Data: "GET /index.html 200 sent 512 bytes"},
+		{Container: web, Data: "GET /missing 404"},
+		{Container: web, Data: "GET /about.html 200 sent 256 bytes"},
+		{Container: api, Data: "POST /users 201"},
+		{Container: api, Data: "starting up"},
+	} {
+		a.observe(message)
+	}
+	out := collect(a)
+	for _, expected := range []string{
+		"# TYPE bytes_sent_total counter\n" +
+			`bytes_sent_total{container_name="web"} 768` + "\n",
+		"# TYPE http_requests_total counter\n" +
+			`http_requests_total{container_name="api",method="POST",status="201"} 1` + "\n" +
+			`http_requests_total{container_name="web",method="GET",status="200"} 2` + "\n" +
+			`http_requests_total{container_name="web",method="GET",status="404"} 1` + "\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	adapter, err := NewMetricsAdapter(&router.Route{Adapter: "metrics", Options: map[string]string{
+		"metrics.histogram.request_duration_seconds": duration,
+		"metrics.buckets": "0.1, 1",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := adapter.(*Adapter)
+	for _, data := range []string{"took 0.05s", "took 0.5s", "took 3s", "took nothing"} {
+		a.observe(&router.Message{Container: web, Data: data})
+	}
+	expected := "# TYPE request_duration_seconds histogram\n" +
+		`request_duration_seconds_bucket{container_name="web",le="0.1"} 1` + "\n" +
+		`request_duration_seconds_bucket{container_name="web",le="1"} 2` + "\n" +
+		`request_duration_seconds_bucket{container_name="web",le="+Inf"} 3` + "\n" +
+		`request_duration_seconds_sum{container_name="web"} 3.55` + "\n" +
+		`request_duration_seconds_count{container_name="web"} 3` + "\n"
+	if out := collect(a); !strings.HasSuffix(out, expected) {
+		t.Errorf("expected %q in:\n%s", expected, out)
+	}
+}
+
+func TestMaxSeries(t *testing.T) {
+	adapter, err := NewMetricsAdapter(&router.Route{Adapter: "metrics", Options: map[string]string{
+		"metrics.counter.http_requests_total": requests,
+		"metrics.max_series":                  "2",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := adapter.(*Adapter)
+	for _, data := range []string{"GET / 200", "GET / 404", "GET / 200", "GET / 500"} {
+		a.observe(&router.Message{Container: web, Data: data})
+		time.Sleep(time.Millisecond)
+	}
+	expected := "# TYPE http_requests_total counter\n" +
+		`http_requests_total{container_name="web",method="GET",status="200"} 2` + "\n" +
+		`http_requests_total{container_name="web",method="GET",status="500"} 1` + "\n"
+	if out := collect(a); !strings.HasSuffix(out, expected) {
+		t.Errorf("expected the least recently updated series to be evicted, %q in:\n%s", expected, out)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	adapter, err := NewMetricsAdapter(&router.Route{Adapter: "metrics", Options: map[string]string{
+		"metrics.counter.http_requests_total": requests,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := adapter.(*Adapter)
+	a.observe(&router.Message{Container: web, Data: "GET / 200"})
+	a.expireSeries(time.Now().Add(defaultExpire + time.Second))
+	if out := collect(a); strings.Contains(out, "http_requests_total{") {
+		t.Errorf("expected the series to expire:\n%s", out)
+	}
+}
+
+type fakeCollector struct{}
+
+func (fakeCollector) Collect(w *bufio.Writer) {}
+
+func TestDuplicateMetrics(t *testing.T) {
+	other := &fakeCollector{}
+	if err := exporter.Register(other, "http_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Unregister(other)
+
+	route := &router.Route{Adapter: "metrics", Options: map[string]string{"metrics.counter.http_requests_total": requests}}
+	adapter, err := NewMetricsAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routertest.Stream(adapter, &router.Message{Container: web, Data: "GET / 200"})
+	if route.Health().State != router.RouteFailed {
+		t.Errorf("expected the route to fail exporting a metric of another route, got %s", route.Health().State)
+	}
+	if out := collect(adapter.(*Adapter)); strings.Contains(out, "http_requests_total{") {
+		t.Errorf("expected no samples:\n%s", out)
+	}
+}
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	adapter, err := NewMetricsAdapter(&router.Route{Adapter: "metrics+udp", Address: conn.LocalAddr().String(), Options: map[string]string{
+		"metrics.counter.http_requests_total":        requests,
+		"metrics.histogram.request_duration_seconds": duration,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan *router.Message, 2)
+	stream <- &router.Message{Container: web, Data: "GET /index.html 200 took 0.25s"}
+	stream <- &router.Message{Container: api, Data: "starting up"}
+	close(stream)
+	adapter.Stream(stream)
+
+	buf := make([]byte, maxPacketSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "http_requests_total:1|c|#container_name:web,method:GET,status:200\n" +
+		"request_duration_seconds:0.25|ms|#container_name:web\n"
+	if packet := string(buf[:n]); packet != expected {
+		t.Errorf("expected %q got %q", expected, packet)
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	for _, options := range []map[string]string{
+		{},
+		{"metrics.counter.http-requests": requests},
+		{"metrics.counter.http_requests_total": "(?P<method>[A-Z]+"},
+		{"metrics.counter.http_requests_total": "(?P<le>[0-9]+)"},
+		{"metrics.counter.http_requests_total": "(?P<container_name>[a-z]+)"},
+		{"metrics.histogram.request_duration_seconds": requests},
+		{"metrics.counter.requests": requests, "metrics.histogram.requests": duration},
+		{"metrics.counter.requests_count": requests, "metrics.histogram.requests": duration},
+		{"metrics.counter.logspout_requests_total": requests},
+		{"metrics.counter.http_requests_total": requests, "metrics.max_series": "0"},
+		{"metrics.counter.http_requests_total": requests, "metrics.expire": "soon"},
+		{"metrics.counter.http_requests_total": requests, "metrics.buckets": "1,0.5"},
+	} {
+		if _, err := NewMetricsAdapter(&router.Route{Adapter: "metrics", Options: options}); err == nil {
+			t.Errorf("expected error for options %v", options)
+		}
+	}
+	route := &router.Route{Adapter: "metrics+nope", Options: map[string]string{"metrics.counter.requests": requests}}
+	if _, err := NewMetricsAdapter(route); err == nil {
+		t.Error("expected error for unknown transport")
+	}
+}
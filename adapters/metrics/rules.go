@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	exporter "github.com/gliderlabs/logspout/metrics"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	counterPrefix   = "metrics.counter."
+	histogramPrefix = "metrics.histogram."
+
+	// valueCapture is the name of the capture holding the value of a sample
+	valueCapture = "value"
+	// containerLabel is the label of the container a sample was counted from
+	containerLabel = "container_name"
+)
+
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// rule turns the log lines matching a regular expression into samples of a
+// counter or histogram, labelled with the named captures of the expression
+type rule struct {
+	name      string
+	histogram bool
+	re        *regexp.Regexp
+	labels    []int // indexes of the captures used as labels
+	value     int   // index of the value capture, or -1 to count lines
+}
+
+// parseRules returns the rules of the metrics.counter.<name> and
+// metrics.histogram.<name> options, sorted by name
+func parseRules(options map[string]string) ([]*rule, error) {
+	var rules []*rule
+	for key, expr := range options {
+		r := &rule{value: -1}
+		switch {
+		case strings.HasPrefix(key, counterPrefix):
+			r.name = strings.TrimPrefix(key, counterPrefix)
+		case strings.HasPrefix(key, histogramPrefix):
+			r.name = strings.TrimPrefix(key, histogramPrefix)
+			r.histogram = true
+		default:
+			continue
+		}
+		if !metricName.MatchString(r.name) || strings.HasPrefix(r.name, exporter.ReservedPrefix) {
+			return nil, errors.New("bad metric name: " + r.name)
+		}
+		var err error
+		if r.re, err = regexp.Compile(expr); err != nil {
+			return nil, errors.New("bad " + key + ": " + err.Error())
+		}
+		for i, name := range r.re.SubexpNames() {
+			switch {
+			case name == "":
+			case name == valueCapture:
+				r.value = i
+			case name == containerLabel || name == "le" || !metricName.MatchString(name) ||
+				strings.HasPrefix(name, "__") || strings.Contains(name, ":"):
+				return nil, errors.New("bad " + key + ": reserved or invalid label " + name)
+			default:
+				r.labels = append(r.labels, i)
+			}
+		}
+		if r.histogram && r.value < 0 {
+			return nil, errors.New("bad " + key + ": no (?P<value>...) capture")
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("bad metrics rules: no metrics.counter or metrics.histogram options")
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].name < rules[j].name })
+	names := make(map[string]bool)
+	for _, r := range rules {
+		for _, name := range r.names() {
+			if names[name] {
+				return nil, errors.New("bad metric name: " + name + " is written by two rules")
+			}
+			names[name] = true
+		}
+	}
+	return rules, nil
+}
+
+// names returns the names of the samples written for a rule
+func (r *rule) names() []string {
+	if r.histogram {
+		return []string{r.name, r.name + "_bucket", r.name + "_sum", r.name + "_count"}
+	}
+	return []string{r.name}
+}
+
+// match returns the label names and values and the value of the sample of a
+// log message, or false if it does not match or its value is not a number
+func (r *rule) match(message *router.Message) ([]string, float64, bool) {
+	m := r.re.FindStringSubmatch(message.Data)
+	if m == nil {
+		return nil, 0, false
+	}
+	value := 1.0
+	if r.value >= 0 {
+		var err error
+		if value, err = strconv.ParseFloat(m[r.value], 64); err != nil {
+			return nil, 0, false
+		}
+	}
+	name := ""
+	if message.Container != nil {
+		name = strings.TrimPrefix(message.Container.Name, "/")
+	}
+	labels := make([]string, 0, 2+2*len(r.labels))
+	labels = append(labels, containerLabel, name)
+	names := r.re.SubexpNames()
+	for _, i := range r.labels {
+		labels = append(labels, names[i], m[i])
+	}
+	return labels, value, true
+}
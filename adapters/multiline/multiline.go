@@ -38,6 +38,7 @@ type Adapter struct {
 	flushAfter      time.Duration
 	checkInterval   time.Duration
 	buffers         map[string]*router.Message
+	started         map[string]time.Time // when each buffer was started
 	nextCheck       <-chan time.Time
 }
 
@@ -131,6 +132,7 @@ func NewMultilineAdapter(route *router.Route) (a router.LogAdapter, err error) {
 		flushAfter:      flushAfter,
 		checkInterval:   checkInterval,
 		buffers:         make(map[string]*router.Message),
+		started:         make(map[string]time.Time),
 		nextCheck:       time.After(checkInterval),
 	}, nil
 }
@@ -172,6 +174,7 @@ func (a *Adapter) Stream(logstream chan *router.Message) { //nolint:gocyclo,goco
 				}
 
 				a.buffers[cID] = message
+				a.started[cID] = time.Now()
 			} else {
 				isLastLine := a.isLastLine(message)
 
@@ -184,18 +187,26 @@ func (a *Adapter) Stream(logstream chan *router.Message) { //nolint:gocyclo,goco
 					a.out <- message
 					if oldExists {
 						delete(a.buffers, cID)
+						delete(a.started, cID)
 					}
 				} else {
 					a.buffers[cID] = message
+					if !oldExists {
+						a.started[cID] = time.Now()
+					}
 				}
 			}
 		case <-a.nextCheck:
 			now := time.Now()
 
 			for key, message := range a.buffers {
-				if message.Time.Add(a.flushAfter).After(now) {
+				// message times come from Docker and may be old when logs
+				// are replayed, so buffers wait flushAfter from when they
+				// were started
+				if !a.started[key].Add(a.flushAfter).After(now) {
 					a.out <- message
 					delete(a.buffers, key)
+					delete(a.started, key)
 				}
 			}
 
@@ -151,6 +151,7 @@ func TestMultiline(t *testing.T) {
 			flushAfter:      time.Second * 10,
 			checkInterval:   time.Millisecond * 100,
 			buffers:         make(map[string]*router.Message),
+			started:         make(map[string]time.Time),
 			nextCheck:       time.After(time.Millisecond * 100),
 			separator:       "\n",
 		}
@@ -177,6 +178,57 @@ func TestMultiline(t *testing.T) {
 	}
 }
 
+// chanAdapter passes the messages it streams to a channel
+type chanAdapter chan *router.Message
+
+func (ca chanAdapter) Stream(logstream chan *router.Message) {
+	for m := range logstream {
+		ca <- m
+	}
+	close(ca)
+}
+
+func TestMultilineFlushAfter(t *testing.T) {
+	in := make(chan *router.Message)
+	flushed := make(chanAdapter, 2)
+	flushAfter := time.Second
+	ma := &Adapter{
+		out:             make(chan *router.Message),
+		subAdapter:      flushed,
+		enableByDefault: true,
+		pattern:         regexp.MustCompile(`^\s`),
+		matchFirstLine:  true,
+		negateMatch:     true,
+		flushAfter:      flushAfter,
+		checkInterval:   time.Millisecond * 10,
+		buffers:         make(map[string]*router.Message),
+		started:         make(map[string]time.Time),
+		nextCheck:       time.After(time.Millisecond * 10),
+		separator:       "\n",
+	}
+	go ma.Stream(in)
+
+	// messages replayed from before a restart are older than flushAfter
+	container := &docker.Container{ID: "test", Config: &docker.Config{}}
+	replayed := time.Now().Add(-time.Hour)
+	start := time.Now()
+	in <- &router.Message{Container: container, Data: "some", Time: replayed}
+	time.Sleep(flushAfter / 2)
+	in <- &router.Message{Container: container, Data: "  multi", Time: replayed}
+	select {
+	case m := <-flushed:
+		if elapsed := time.Since(start); elapsed < flushAfter {
+			t.Errorf("expected the message to be buffered for %v, flushed after %v", flushAfter, elapsed)
+		}
+		if m.Data != "some\n  multi" {
+			t.Errorf("Expected: 'some\\n  multi', Got: '%v'", replaceNewLines(m.Data))
+		}
+	case <-time.After(flushAfter * 2):
+		t.Error("expected the message to be flushed after flushAfter")
+	}
+	close(in)
+}
+
 func TestContainerEnv(t *testing.T) {
 	tests := []envTestData{
 		{
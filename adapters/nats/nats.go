@@ -0,0 +1,294 @@
+package nats
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	defaultSubject       = "logspout"
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	defaultAckTimeout    = 5 * time.Second
+)
+
+var hostname string
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewNatsAdapter, "nats")
+	router.SecretOptions("nats.password", "nats.token")
+}
+
+// NewNatsAdapter returns a configured nats.Adapter
+func NewNatsAdapter(route *router.Route) (router.LogAdapter, error) {
+	scheme := route.AdapterTransport("nats")
+	switch scheme {
+	case "nats", "tcp":
+		scheme = "nats"
+	case "tls":
+	default:
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:     route,
+		jetstream: route.Options["nats.jetstream"] == "true",
+	}
+	subject := route.Options["nats.subject"]
+	if subject == "" {
+		subject = defaultSubject
+	}
+	var err error
+	if a.subject, err = template.New("subject").Parse(subject); err != nil {
+		return nil, errors.New("bad nats.subject: " + err.Error())
+	}
+	if tmplStr := route.Options["nats.template"]; tmplStr != "" {
+		if a.tmpl, err = template.New("nats").Parse(tmplStr); err != nil {
+			return nil, errors.New("bad nats.template: " + err.Error())
+		}
+	}
+	if a.ackTimeout, err = route.DurationOption("nats.ack_timeout", defaultAckTimeout); err != nil {
+		return nil, err
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+
+	servers := strings.Split(route.Address, ",")
+	for i, server := range servers {
+		servers[i] = scheme + "://" + server
+	}
+	opts, err := connectOptions(route.Options)
+	if err != nil {
+		return nil, err
+	}
+	if a.conn, err = nats.Connect(strings.Join(servers, ","), opts...); err != nil {
+		return nil, err
+	}
+	if a.jetstream {
+		// JetStream acknowledges messages published with a reply subject,
+		// which all go to a single inbox subscription
+		a.inbox = nats.NewInbox() + "."
+		a.acks = make(chan *nats.Msg, a.batchSize)
+		if _, err = a.conn.ChanSubscribe(a.inbox+"*", a.acks); err != nil {
+			a.conn.Close()
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// connectOptions returns the options of the connection to NATS, which keeps
+// reconnecting to the servers of the route when it is lost
+func connectOptions(options map[string]string) ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name("logspout"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Println("nats: disconnected:", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			log.Println("nats: reconnected to", conn.ConnectedUrl())
+		}),
+	}
+	user := options["nats.user"]
+	password := options["nats.password"]
+	if user == "" {
+		user = cfg.GetEnvDefault("NATS_USER", "")
+		password = cfg.GetEnvDefault("NATS_PASSWORD", "")
+	}
+	token := options["nats.token"]
+	if token == "" {
+		token = cfg.GetEnvDefault("NATS_TOKEN", "")
+	}
+	switch {
+	case options["nats.creds"] != "":
+		if _, err := os.Stat(options["nats.creds"]); err != nil {
+			return nil, errors.New("bad nats.creds: " + err.Error())
+		}
+		opts = append(opts, nats.UserCredentials(options["nats.creds"]))
+	case user != "":
+		opts = append(opts, nats.UserInfo(user, password))
+	case token != "":
+		opts = append(opts, nats.Token(token))
+	}
+	return opts, nil
+}
+
+// Adapter publishes log messages to NATS subjects, or JetStream streams
+type Adapter struct {
+	route         *router.Route
+	conn          *nats.Conn
+	jetstream     bool
+	inbox         string         // prefix of the reply subjects of JetStream acks
+	acks          chan *nats.Msg // JetStream acks
+	seq           uint64         // last reply subject of the inbox
+	subject       *template.Template
+	tmpl          *template.Template
+	ackTimeout    time.Duration
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// Stream publishes batches of log messages
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	defer a.conn.Close()
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	msgs := make([]*nats.Msg, 0, len(batch))
+	for _, message := range batch {
+		msg, err := a.newMsg(message)
+		if err != nil {
+			log.Println("nats:", err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if !a.jetstream {
+		// core NATS has no delivery guarantee: the connection buffers
+		// messages while it reconnects, and flushing only waits for the
+		// server to have read them
+		for _, msg := range msgs {
+			if err := a.conn.PublishMsg(msg); err != nil {
+				log.Println("nats: dropping message:", err)
+				a.route.CountWriteError()
+			}
+		}
+		if err := a.conn.FlushTimeout(a.ackTimeout); err != nil {
+			log.Println("nats:", err)
+			return
+		}
+		a.route.MarkWritten(batch...)
+		return
+	}
+	err := a.route.Retry(a.retries, func() error {
+		var err error
+		msgs, err = a.publish(msgs)
+		return err
+	}, batch...)
+	if err != nil {
+		log.Printf("nats: dropping %d messages: %v", len(msgs), err)
+		a.route.CountWriteError()
+	}
+}
+
+// publish publishes messages to JetStream, waiting for their acks. It returns
+// the messages to retry along with an error when some or all of them failed.
+func (a *Adapter) publish(msgs []*nats.Msg) ([]*nats.Msg, error) {
+	errs := make([]error, len(msgs))
+	pending := make(map[string]int, len(msgs))
+	for i, msg := range msgs {
+		// each publish gets a reply subject of its own, so acks of earlier
+		// attempts aren't taken for those of this one
+		a.seq++
+		msg.Reply = a.inbox + strconv.FormatUint(a.seq, 10)
+		if errs[i] = a.conn.PublishMsg(msg); errs[i] == nil {
+			errs[i] = nats.ErrTimeout
+			pending[msg.Reply] = i
+		}
+	}
+	timer := time.NewTimer(a.ackTimeout)
+	defer timer.Stop()
+	for len(pending) > 0 {
+		select {
+		case ack := <-a.acks:
+			if i, ok := pending[ack.Subject]; ok {
+				errs[i] = pubAckError(ack.Data)
+				delete(pending, ack.Subject)
+			}
+		case <-timer.C:
+			pending = nil
+		}
+	}
+	var retry []*nats.Msg
+	var lastErr error
+	for i, err := range errs {
+		if err != nil {
+			retry = append(retry, msgs[i])
+			lastErr = err
+		}
+	}
+	if len(retry) == 0 {
+		return nil, nil
+	}
+	return retry, fmt.Errorf("%d of %d messages not acknowledged: %v", len(retry), len(msgs), lastErr)
+}
+
+// pubAck is the response of JetStream to a published message
+type pubAck struct {
+	Stream string `json:"stream"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// pubAckError returns the error of a JetStream response, or nil when it
+// acknowledges the message
+func pubAckError(data []byte) error {
+	var ack pubAck
+	if err := json.Unmarshal(data, &ack); err != nil {
+		return fmt.Errorf("bad ack %q", data)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("jetstream error %d: %s", ack.Error.Code, ack.Error.Description)
+	}
+	if ack.Stream == "" {
+		return fmt.Errorf("bad ack %q", data)
+	}
+	return nil
+}
+
+func (a *Adapter) newMsg(message *router.Message) (*nats.Msg, error) {
+	m := &Message{message}
+	var subject bytes.Buffer
+	if err := a.subject.Execute(&subject, m); err != nil {
+		return nil, err
+	}
+	msg := &nats.Msg{Subject: subject.String()}
+	if a.tmpl != nil {
+		var buf bytes.Buffer
+		if err := a.tmpl.Execute(&buf, m); err != nil {
+			return nil, err
+		}
+		msg.Data = buf.Bytes()
+		return msg, nil
+	}
+	var err error
+	msg.Data, err = json.Marshal(router.NewRecord(message, hostname))
+	return msg, err
+}
+
+// Message extends router.Message for subject and message templates
+type Message struct {
+	*router.Message
+}
+
+// ContainerName returns the message's container name
+func (m *Message) ContainerName() string {
+	if m.Container == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Container.Name, "/")
+}
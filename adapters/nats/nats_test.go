@@ -0,0 +1,215 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/nats-io/nats.go"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+)
+
+var container = &docker.Container{
+	ID:     "8dfafdbc3a40",
+	Name:   "/web",
+	Config: &docker.Config{Image: "nginx:1.21"},
+}
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+}
+
+// published is a message published to the fake server
+type published struct {
+	subject string
+	data    []byte
+}
+
+// startServer runs a fake NATS server sending the messages published by
+// clients to received. Messages with a reply subject are acknowledged like
+// JetStream does when ack is true.
+func startServer(t *testing.T, ack bool, received chan<- published) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(c, ack, received)
+		}
+	}()
+	return l
+}
+
+func serve(c net.Conn, ack bool, received chan<- published) {
+	defer c.Close()
+	fmt.Fprintf(c, "INFO {\"server_id\":\"test\",\"version\":\"2.2.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(c)
+	subs := make(map[string]string) // subject to sid
+	seq := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			io.WriteString(c, "PONG\r\n")
+		case "SUB":
+			subs[args[1]] = args[len(args)-1]
+		case "PUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			subject, reply := args[1], ""
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			var response string
+			if reply != "" && ack {
+				seq++
+				response = fmt.Sprintf(`{"stream":"LOGS","seq":%d}`, seq)
+			}
+			received <- published{subject, data[:size]}
+			if response == "" || reply == "" {
+				continue
+			}
+			// replies go to the wildcard inbox subscription of the client
+			sid := subs[reply[:strings.LastIndex(reply, ".")+1]+"*"]
+			fmt.Fprintf(c, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(response), response)
+		}
+	}
+}
+
+func TestNatsCore(t *testing.T) {
+	received := make(chan published, 10)
+	l := startServer(t, false, received)
+	defer l.Close()
+
+	route := &router.Route{Adapter: "nats", Address: l.Addr().String(), Options: map[string]string{
+		"nats.subject": "logs.{{.ContainerName}}",
+	}}
+	adapter, err := NewNatsAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routertest.Stream(adapter, &router.Message{Container: container, Source: "stdout", Data: "hello", Time: time.Now()})
+
+	select {
+	case msg := <-received:
+		if msg.subject != "logs.web" {
+			t.Errorf("expected subject logs.web got %s", msg.subject)
+		}
+		var record router.Record
+		if err := json.Unmarshal(msg.data, &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Message != "hello" || record.Container.Name != "web" || record.Container.Image != "nginx:1.21" {
+			t.Errorf("unexpected record %s", msg.data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+}
+
+func TestNatsJetStream(t *testing.T) {
+	received := make(chan published, 10)
+	l := startServer(t, true, received)
+	defer l.Close()
+
+	route := &router.Route{Adapter: "nats", Address: l.Addr().String(), Options: map[string]string{
+		"nats.jetstream": "true",
+		"nats.template":  "{{.ContainerName}}: {{.Data}}",
+	}}
+	adapter, err := NewNatsAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routertest.Stream(adapter,
+		&router.Message{Container: container, Data: "one", Time: time.Now()},
+		&router.Message{Container: container, Data: "two", Time: time.Now()},
+	)
+
+	var data []string
+	for len(received) > 0 {
+		msg := <-received
+		if msg.subject == defaultSubject {
+			data = append(data, string(msg.data))
+		}
+	}
+	if strings.Join(data, ",") != "web: one,web: two" {
+		t.Errorf("unexpected messages %q", data)
+	}
+}
+
+func TestNatsJetStreamRetry(t *testing.T) {
+	received := make(chan published, 10)
+	l := startServer(t, false, received)
+	defer l.Close()
+
+	route := &router.Route{Adapter: "nats", Address: l.Addr().String(), Options: map[string]string{
+		"nats.jetstream":   "true",
+		"nats.ack_timeout": "50ms",
+		"retry.count":      "1",
+	}}
+	adapter, err := NewNatsAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := adapter.(*Adapter)
+	msg, err := a.newMsg(&router.Message{Container: container, Data: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry, err := a.publish([]*nats.Msg{msg})
+	if err == nil || len(retry) != 1 {
+		t.Errorf("expected unacknowledged message to be retried, got %d and %v", len(retry), err)
+	}
+	a.conn.Close()
+}
+
+func TestNatsPubAckError(t *testing.T) {
+	for data, ok := range map[string]bool{
+		`{"stream":"LOGS","seq":1}`:                            true,
+		`{"error":{"code":503,"description":"no responders"}}`: false,
+		`{}`:  false,
+		`+OK`: false,
+	} {
+		if err := pubAckError([]byte(data)); (err == nil) != ok {
+			t.Errorf("unexpected error %v for ack %s", err, data)
+		}
+	}
+}
+
+func TestNatsBadOptions(t *testing.T) {
+	for _, route := range []*router.Route{
+		{Adapter: "nats+udp", Address: "localhost:4222"},
+		{Adapter: "nats", Address: "localhost:4222", Options: map[string]string{"nats.subject": "{{"}},
+		{Adapter: "nats", Address: "localhost:4222", Options: map[string]string{"nats.ack_timeout": "soon"}},
+		{Adapter: "nats", Address: "localhost:4222", Options: map[string]string{"nats.creds": "/nonexistent.creds"}},
+		{Adapter: "nats", Address: "localhost:4222", Options: map[string]string{"batch.size": "0"}},
+	} {
+		if _, err := NewNatsAdapter(route); err == nil {
+			t.Errorf("expected error for route %v", route)
+		}
+	}
+}
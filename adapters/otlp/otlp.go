@@ -0,0 +1,281 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	logsPath = "/v1/logs"
+
+	// ScopeName is the instrumentation scope of the exported log records
+	ScopeName = "logspout"
+
+	// severities of stdout and stderr messages
+	severityInfo  = 9
+	severityError = 17
+
+	defaultBatchSize     = 512
+	defaultBatchInterval = time.Second
+	requestTimeout       = 30 * time.Second
+
+	headerOption = "otlp.header."
+)
+
+var hostname string
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewOtlpAdapter, "otlp")
+	router.SecretOptions(headerOption)
+}
+
+// NewOtlpAdapter returns a configured otlp.Adapter
+func NewOtlpAdapter(route *router.Route) (router.LogAdapter, error) {
+	scheme := route.AdapterTransport("http")
+	if scheme != "http" && scheme != "https" {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:    route,
+		url:      scheme + "://" + route.Address + route.Path,
+		client:   &http.Client{Timeout: requestTimeout},
+		encoding: route.Options["otlp.encoding"],
+		gzip:     route.Options["otlp.compression"] == "gzip",
+		header:   make(http.Header),
+	}
+	// like OTEL_EXPORTER_OTLP_ENDPOINT, an address without a path is the
+	// base URL of the collector
+	if route.Path == "" && !strings.Contains(route.Address, "/") {
+		a.url += logsPath
+	}
+	switch a.encoding {
+	case "":
+		a.encoding = "protobuf"
+	case "protobuf", "json":
+	default:
+		return nil, errors.New("bad otlp.encoding: " + a.encoding)
+	}
+	switch route.Options["otlp.compression"] {
+	case "", "none", "gzip":
+	default:
+		return nil, errors.New("bad otlp.compression: " + route.Options["otlp.compression"])
+	}
+	if labels := route.Options["otlp.labels"]; labels != "" {
+		a.labels = strings.Split(labels, ",")
+	}
+	if err := a.setHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), route.Options); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// setHeaders sets the request headers listed in OTEL_EXPORTER_OTLP_HEADERS,
+// as comma separated key=value pairs with URL encoded values, and those of
+// otlp.header.<name> options
+func (a *Adapter) setHeaders(env string, options map[string]string) error {
+	for _, pair := range strings.Split(env, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return errors.New("bad OTEL_EXPORTER_OTLP_HEADERS: " + pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return errors.New("bad OTEL_EXPORTER_OTLP_HEADERS: " + err.Error())
+		}
+		a.header.Set(strings.TrimSpace(kv[0]), value)
+	}
+	for key, value := range options {
+		if strings.HasPrefix(key, headerOption) {
+			a.header.Set(strings.TrimPrefix(key, headerOption), value)
+		}
+	}
+	return nil
+}
+
+// Adapter exports log messages as OpenTelemetry log records with OTLP/HTTP
+type Adapter struct {
+	route         *router.Route
+	url           string
+	client        *http.Client
+	encoding      string
+	gzip          bool
+	header        http.Header
+	labels        []string
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// Stream exports batches of log messages
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	req := a.newRequest(batch, time.Now())
+	var body []byte
+	var err error
+	if a.encoding == "json" {
+		body, err = json.Marshal(req)
+	} else {
+		body = encodeProtobuf(req)
+	}
+	if err != nil {
+		log.Println("otlp:", err)
+		return
+	}
+	if a.gzip {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		w.Write(body)
+		w.Close()
+		body = b.Bytes()
+	}
+	err = a.route.Retry(a.retries, func() error {
+		return a.post(body)
+	}, batch...)
+	if err != nil {
+		log.Printf("otlp: dropping %d messages: %v", len(batch), err)
+		a.route.CountWriteError()
+	}
+}
+
+func (a *Adapter) post(body []byte) error {
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(body))
+	if err != nil {
+		return router.Permanent(err)
+	}
+	for key, values := range a.header {
+		req.Header[key] = values
+	}
+	if a.encoding == "json" {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	if a.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return router.CheckHTTPResponse(resp)
+}
+
+// newRequest groups messages by container, the resource of their log records
+func (a *Adapter) newRequest(batch []*router.Message, observed time.Time) *ExportLogsRequest {
+	req := &ExportLogsRequest{}
+	byContainer := make(map[string]*ScopeLogs)
+	for _, message := range batch {
+		var id string
+		if message.Container != nil {
+			id = message.Container.ID
+		}
+		scope, ok := byContainer[id]
+		if !ok {
+			scope = &ScopeLogs{Scope: Scope{Name: ScopeName}}
+			byContainer[id] = scope
+			req.ResourceLogs = append(req.ResourceLogs, &ResourceLogs{
+				Resource:  Resource{Attributes: a.resourceAttributes(message)},
+				ScopeLogs: []*ScopeLogs{scope},
+			})
+		}
+		scope.LogRecords = append(scope.LogRecords, NewLogRecord(message, observed))
+	}
+	return req
+}
+
+// resourceAttributes returns the attributes of the container of a message,
+// named after the OpenTelemetry semantic conventions
+func (a *Adapter) resourceAttributes(message *router.Message) []KeyValue {
+	attrs := []KeyValue{stringAttribute("host.name", hostname)}
+	c := message.Container
+	if c == nil {
+		return attrs
+	}
+	attrs = append(attrs,
+		stringAttribute("container.id", c.ID),
+		stringAttribute("container.name", strings.TrimPrefix(c.Name, "/")),
+	)
+	if c.Config == nil {
+		return attrs
+	}
+	if c.Config.Image != "" {
+		name, tag := splitImage(c.Config.Image)
+		attrs = append(attrs, stringAttribute("container.image.name", name))
+		if tag != "" {
+			attrs = append(attrs, KeyValue{"container.image.tags", NewValue([]interface{}{tag})})
+		}
+	}
+	labels := c.Config.Labels
+	if service := labels["com.docker.compose.service"]; service != "" {
+		attrs = append(attrs, stringAttribute("service.name", service))
+	} else if service := labels["com.docker.swarm.service.name"]; service != "" {
+		attrs = append(attrs, stringAttribute("service.name", service))
+	}
+	for _, key := range a.labels {
+		if value, ok := labels[key]; ok {
+			attrs = append(attrs, stringAttribute("container.label."+key, value))
+		}
+	}
+	return attrs
+}
+
+// splitImage splits an image reference into its name and tag, dropping any digest
+func splitImage(image string) (string, string) {
+	if i := strings.IndexByte(image, '@'); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndexByte(image, ':'); i > strings.LastIndexByte(image, '/') {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
+
+// NewLogRecord returns the log record of a message, with its source as the
+// log.iostream attribute along with the Fields parsed by the route's parse
+// option. Messages written to stderr have the ERROR severity, others INFO.
+func NewLogRecord(message *router.Message, observed time.Time) *LogRecord {
+	record := &LogRecord{
+		TimeUnixNano:         uint64(message.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(observed.UnixNano()),
+		SeverityNumber:       severityInfo,
+		SeverityText:         "INFO",
+		Body:                 NewValue(message.Data),
+	}
+	if message.Source == "stderr" {
+		record.SeverityNumber = severityError
+		record.SeverityText = "ERROR"
+	}
+	if message.Source != "" {
+		record.Attributes = append(record.Attributes, stringAttribute("log.iostream", message.Source))
+	}
+	for _, key := range sortedKeys(message.Fields) {
+		record.Attributes = append(record.Attributes, KeyValue{key, NewValue(message.Fields[key])})
+	}
+	return record
+}
@@ -0,0 +1,252 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+var container = &docker.Container{
+	ID:   "8dfafdbc3a40",
+	Name: "/shop_web_1",
+	Config: &docker.Config{
+		Image: "registry.example.com:5000/nginx:1.21",
+		Labels: map[string]string{
+			"com.docker.compose.service": "web",
+			"com.example.team":           "shop",
+		},
+	},
+}
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+}
+
+type request struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func newTestServer(t *testing.T, requests chan<- request, statuses ...int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.URL.Path, r.Header, body}
+	}))
+}
+
+func streamMessages(t *testing.T, address string, options map[string]string, messages ...*router.Message) {
+	route := &router.Route{Adapter: "otlp", Address: address, Options: options}
+	adapter, err := NewOtlpAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan *router.Message, len(messages))
+	for _, m := range messages {
+		stream <- m
+	}
+	close(stream)
+	adapter.Stream(stream)
+}
+
+func TestOtlpJSON(t *testing.T) {
+	requests := make(chan request, 1)
+	srv := newTestServer(t, requests, http.StatusServiceUnavailable)
+	defer srv.Close()
+	now := time.Unix(1500000000, 5)
+	streamMessages(t, strings.TrimPrefix(srv.URL, "http://"), map[string]string{
+		"otlp.encoding": "json",
+		"otlp.labels":   "com.example.team",
+	},
+		&router.Message{Container: container, Source: "stdout", Data: "hello", Time: now, Fields: map[string]interface{}{"status": float64(200)}},
+		&router.Message{Container: container, Source: "stderr", Data: "failed", Time: now},
+	)
+
+	req := <-requests
+	if req.path != logsPath {
+		t.Errorf("expected path %s got %s", logsPath, req.path)
+	}
+	if req.header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected content type %s", req.header.Get("Content-Type"))
+	}
+	var body struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]interface{}
+				}
+			}
+			ScopeLogs []struct {
+				Scope      struct{ Name string }
+				LogRecords []map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.ResourceLogs) != 1 {
+		t.Fatalf("expected 1 resource got %d", len(body.ResourceLogs))
+	}
+	attrs := make(map[string]interface{})
+	for _, attr := range body.ResourceLogs[0].Resource.Attributes {
+		attrs[attr.Key] = attr.Value["stringValue"]
+	}
+	for key, value := range map[string]string{
+		"container.id":                     "8dfafdbc3a40",
+		"container.name":                   "shop_web_1",
+		"container.image.name":             "registry.example.com:5000/nginx",
+		"service.name":                     "web",
+		"container.label.com.example.team": "shop",
+	} {
+		if attrs[key] != value {
+			t.Errorf("expected resource attribute %s=%s got %v", key, value, attrs[key])
+		}
+	}
+	scope := body.ResourceLogs[0].ScopeLogs[0]
+	if scope.Scope.Name != ScopeName || len(scope.LogRecords) != 2 {
+		t.Fatalf("unexpected scope logs %v", scope)
+	}
+	record := scope.LogRecords[0]
+	if record["timeUnixNano"] != "1500000000000000005" {
+		t.Errorf("unexpected time %v", record["timeUnixNano"])
+	}
+	if record["severityNumber"] != float64(severityInfo) || scope.LogRecords[1]["severityNumber"] != float64(severityError) {
+		t.Errorf("unexpected severities %v and %v", record["severityNumber"], scope.LogRecords[1]["severityNumber"])
+	}
+	expected := []interface{}{
+		map[string]interface{}{"key": "log.iostream", "value": map[string]interface{}{"stringValue": "stdout"}},
+		map[string]interface{}{"key": "status", "value": map[string]interface{}{"doubleValue": float64(200)}},
+	}
+	if !reflect.DeepEqual(record["attributes"], expected) {
+		t.Errorf("expected attributes %v got %v", expected, record["attributes"])
+	}
+}
+
+// fields decodes the fields of a protobuf message by number
+func fields(t *testing.T, b []byte) map[int][][]byte {
+	m := make(map[int][][]byte)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		var v []byte
+		switch key & 7 {
+		case wireVarint:
+			_, n = binary.Uvarint(b)
+			v, b = b[:n], b[n:]
+		case wireFixed64:
+			v, b = b[:8], b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			v, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		m[int(key>>3)] = append(m[int(key>>3)], v)
+	}
+	return m
+}
+
+func TestOtlpProtobuf(t *testing.T) {
+	requests := make(chan request, 1)
+	srv := newTestServer(t, requests)
+	defer srv.Close()
+	other := &docker.Container{ID: "3b6ba57db54a", Name: "/db"}
+	now := time.Unix(1500000000, 0)
+	streamMessages(t, strings.TrimPrefix(srv.URL, "http://")+"/otlp/logs", map[string]string{
+		"otlp.compression":  "gzip",
+		"otlp.header.X-Key": "secret",
+	},
+		&router.Message{Container: container, Source: "stdout", Data: "one", Time: now},
+		&router.Message{Container: other, Source: "stderr", Data: "two", Time: now},
+		&router.Message{Container: container, Source: "stdout", Data: "three", Time: now},
+	)
+
+	req := <-requests
+	if req.path != "/otlp/logs" {
+		t.Errorf("expected the route path, got %s", req.path)
+	}
+	if req.header.Get("X-Key") != "secret" || req.header.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected headers %v", req.header)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(req.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r)
+
+	resources := fields(t, body)[1]
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources got %d", len(resources))
+	}
+	for i, lines := range [][]string{{"one", "three"}, {"two"}} {
+		scopeLogs := fields(t, fields(t, resources[i])[2][0])
+		if name := fields(t, scopeLogs[1][0])[1][0]; string(name) != ScopeName {
+			t.Errorf("unexpected scope %s", name)
+		}
+		records := scopeLogs[2]
+		if len(records) != len(lines) {
+			t.Fatalf("expected %d records got %d", len(lines), len(records))
+		}
+		for j, line := range lines {
+			record := fields(t, records[j])
+			if ts := binary.LittleEndian.Uint64(record[1][0]); ts != uint64(now.UnixNano()) {
+				t.Errorf("unexpected time %d", ts)
+			}
+			if body := fields(t, record[5][0])[1][0]; string(body) != line {
+				t.Errorf("expected body %s got %s", line, body)
+			}
+		}
+	}
+	attr := fields(t, fields(t, fields(t, resources[0])[1][0])[1][1])
+	if string(attr[1][0]) != "container.id" || string(fields(t, attr[2][0])[1][0]) != container.ID {
+		t.Errorf("unexpected resource attribute %q", attr)
+	}
+}
+
+func TestOtlpHeadersEnv(t *testing.T) {
+	a := &Adapter{header: make(http.Header)}
+	err := a.setHeaders("api-key=abc%3D%3D, X-Tenant = team-a", map[string]string{"otlp.header.X-Tenant": "team-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.header.Get("Api-Key") != "abc==" || a.header.Get("X-Tenant") != "team-b" {
+		t.Errorf("unexpected headers %v", a.header)
+	}
+	if err := a.setHeaders("api-key", nil); err == nil {
+		t.Error("expected error for header without value")
+	}
+}
+
+func TestOtlpBadOptions(t *testing.T) {
+	os.Unsetenv("OTEL_EXPORTER_OTLP_HEADERS")
+	for _, route := range []*router.Route{
+		{Adapter: "otlp+udp", Address: "localhost:4318"},
+		{Adapter: "otlp", Address: "localhost:4318", Options: map[string]string{"otlp.encoding": "thrift"}},
+		{Adapter: "otlp", Address: "localhost:4318", Options: map[string]string{"otlp.compression": "zstd"}},
+		{Adapter: "otlp", Address: "localhost:4318", Options: map[string]string{"batch.size": "0"}},
+	} {
+		if _, err := NewOtlpAdapter(route); err == nil {
+			t.Errorf("expected error for %s with options %v", route.Adapter, route.Options)
+		}
+	}
+}
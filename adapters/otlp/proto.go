@@ -0,0 +1,123 @@
+package otlp
+
+import "math"
+
+// encodeProtobuf encodes an ExportLogsServiceRequest:
+//
+//	message ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	message ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+//	message Resource { repeated KeyValue attributes = 1; }
+//	message ScopeLogs { InstrumentationScope scope = 1; repeated LogRecord log_records = 2; }
+//	message InstrumentationScope { string name = 1; }
+//	message LogRecord {
+//		fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2; string severity_text = 3;
+//		AnyValue body = 5; repeated KeyValue attributes = 6; fixed64 observed_time_unix_nano = 11;
+//	}
+func encodeProtobuf(req *ExportLogsRequest) []byte {
+	var b []byte
+	for _, rl := range req.ResourceLogs {
+		var r []byte
+		r = appendBytes(r, 1, appendKeyValues(nil, 1, rl.Resource.Attributes))
+		for _, sl := range rl.ScopeLogs {
+			var s []byte
+			s = appendBytes(s, 1, appendBytes(nil, 1, []byte(sl.Scope.Name)))
+			for _, record := range sl.LogRecords {
+				s = appendBytes(s, 2, encodeLogRecord(record))
+			}
+			r = appendBytes(r, 2, s)
+		}
+		b = appendBytes(b, 1, r)
+	}
+	return b
+}
+
+func encodeLogRecord(record *LogRecord) []byte {
+	var b []byte
+	b = appendFixed64(b, 1, record.TimeUnixNano)
+	b = appendVarint(b, 2, uint64(record.SeverityNumber))
+	b = appendBytes(b, 3, []byte(record.SeverityText))
+	b = appendBytes(b, 5, encodeValue(record.Body))
+	b = appendKeyValues(b, 6, record.Attributes)
+	return appendFixed64(b, 11, record.ObservedTimeUnixNano)
+}
+
+// appendKeyValues appends attributes as a repeated field:
+//
+//	message KeyValue { string key = 1; AnyValue value = 2; }
+func appendKeyValues(b []byte, field int, kvs []KeyValue) []byte {
+	for _, kv := range kvs {
+		var e []byte
+		e = appendBytes(e, 1, []byte(kv.Key))
+		e = appendBytes(e, 2, encodeValue(kv.Value))
+		b = appendBytes(b, field, e)
+	}
+	return b
+}
+
+// encodeValue encodes an AnyValue:
+//
+//	message AnyValue {
+//		oneof value {
+//			string string_value = 1; bool bool_value = 2; int64 int_value = 3;
+//			double double_value = 4; ArrayValue array_value = 5; KeyValueList kvlist_value = 6;
+//		}
+//	}
+//	message ArrayValue { repeated AnyValue values = 1; }
+//	message KeyValueList { repeated KeyValue values = 1; }
+func encodeValue(v AnyValue) []byte {
+	switch {
+	case v.StringValue != nil:
+		return appendBytes(nil, 1, []byte(*v.StringValue))
+	case v.BoolValue != nil:
+		if *v.BoolValue {
+			return appendVarint(nil, 2, 1)
+		}
+		return appendVarint(nil, 2, 0)
+	case v.IntValue != nil:
+		return appendVarint(nil, 3, uint64(*v.IntValue))
+	case v.DoubleValue != nil:
+		return appendFixed64(nil, 4, math.Float64bits(*v.DoubleValue))
+	case v.ArrayValue != nil:
+		var a []byte
+		for _, e := range v.ArrayValue.Values {
+			a = appendBytes(a, 1, encodeValue(e))
+		}
+		return appendBytes(nil, 5, a)
+	case v.KvlistValue != nil:
+		return appendBytes(nil, 6, appendKeyValues(nil, 1, v.KvlistValue.Values))
+	}
+	return nil
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field<<3|wireVarint))
+	return appendUvarint(b, v)
+}
+
+func appendFixed64(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field<<3|wireFixed64))
+	for i := 0; i < 8; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendUvarint(b, uint64(field<<3|wireBytes))
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
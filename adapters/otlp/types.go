@@ -0,0 +1,121 @@
+package otlp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The types below follow the messages of opentelemetry/proto/collector/logs/v1,
+// with the field names of their OTLP/JSON encoding.
+
+// ExportLogsRequest is an ExportLogsServiceRequest
+type ExportLogsRequest struct {
+	ResourceLogs []*ResourceLogs `json:"resourceLogs"`
+}
+
+// ResourceLogs are the log records of a resource, a container
+type ResourceLogs struct {
+	Resource  Resource     `json:"resource"`
+	ScopeLogs []*ScopeLogs `json:"scopeLogs"`
+}
+
+// Resource is the entity log records are produced by
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// ScopeLogs are the log records of an instrumentation scope
+type ScopeLogs struct {
+	Scope      Scope        `json:"scope"`
+	LogRecords []*LogRecord `json:"logRecords"`
+}
+
+// Scope is an InstrumentationScope
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// LogRecord is a log message
+type LogRecord struct {
+	TimeUnixNano         uint64     `json:"timeUnixNano,string"`
+	ObservedTimeUnixNano uint64     `json:"observedTimeUnixNano,string"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 AnyValue   `json:"body"`
+	Attributes           []KeyValue `json:"attributes,omitempty"`
+}
+
+// KeyValue is an attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue is the value of an attribute or log record body, with exactly
+// one of its fields set
+type AnyValue struct {
+	StringValue *string       `json:"stringValue,omitempty"`
+	BoolValue   *bool         `json:"boolValue,omitempty"`
+	IntValue    *int64        `json:"intValue,string,omitempty"`
+	DoubleValue *float64      `json:"doubleValue,omitempty"`
+	ArrayValue  *ArrayValue   `json:"arrayValue,omitempty"`
+	KvlistValue *KeyValueList `json:"kvlistValue,omitempty"`
+}
+
+// ArrayValue is a list of values
+type ArrayValue struct {
+	Values []AnyValue `json:"values"`
+}
+
+// KeyValueList is a map of values
+type KeyValueList struct {
+	Values []KeyValue `json:"values"`
+}
+
+// NewValue returns the AnyValue of the values found in messages, like those
+// parsed from JSON. Other values are converted to their string representation.
+func NewValue(v interface{}) AnyValue {
+	switch v := v.(type) {
+	case string:
+		return AnyValue{StringValue: &v}
+	case bool:
+		return AnyValue{BoolValue: &v}
+	case int:
+		i := int64(v)
+		return AnyValue{IntValue: &i}
+	case int64:
+		return AnyValue{IntValue: &v}
+	case float64:
+		return AnyValue{DoubleValue: &v}
+	case []interface{}:
+		array := &ArrayValue{Values: make([]AnyValue, len(v))}
+		for i, e := range v {
+			array.Values[i] = NewValue(e)
+		}
+		return AnyValue{ArrayValue: array}
+	case map[string]interface{}:
+		list := &KeyValueList{}
+		for _, key := range sortedKeys(v) {
+			list.Values = append(list.Values, KeyValue{key, NewValue(v[key])})
+		}
+		return AnyValue{KvlistValue: list}
+	case nil:
+		return AnyValue{}
+	default:
+		s := fmt.Sprint(v)
+		return AnyValue{StringValue: &s}
+	}
+}
+
+func stringAttribute(key, value string) KeyValue {
+	return KeyValue{key, NewValue(value)}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"text/template"
+	"time"
 
 	"github.com/gliderlabs/logspout/router"
 )
@@ -33,10 +34,20 @@ func NewRawAdapter(route *router.Route) (router.LogAdapter, error) {
 	if !found {
 		return nil, errors.New("bad transport: " + route.Adapter)
 	}
-	conn, err := transport.Dial(route.Address, route.Options)
+	spool, err := router.OpenSpool(route)
 	if err != nil {
 		return nil, err
 	}
+	conn, err := transport.Dial(route.Address, route.Options)
+	if err != nil {
+		if spool == nil {
+			return nil, err
+		}
+		// spool until the destination can be dialed, rather than failing
+		// the route and losing what was spooled before a restart
+		log.Println("raw: spooling to disk until reconnected:", err)
+		route.CountWriteError()
+	}
 	tmplStr := "{{.Data}}\n"
 	if os.Getenv("RAW_FORMAT") != "" {
 		tmplStr = os.Getenv("RAW_FORMAT")
@@ -46,34 +57,102 @@ func NewRawAdapter(route *router.Route) (router.LogAdapter, error) {
 		return nil, err
 	}
 	return &Adapter{
-		route: route,
-		conn:  conn,
-		tmpl:  tmpl,
+		route:     route,
+		conn:      conn,
+		tmpl:      tmpl,
+		transport: transport,
+		spool:     spool,
 	}, nil
 }
 
 // Adapter is a simple adapter that streams log output to a connection without any templating
 type Adapter struct {
-	conn  net.Conn
-	route *router.Route
-	tmpl  *template.Template
+	conn      net.Conn
+	route     *router.Route
+	tmpl      *template.Template
+	transport router.AdapterTransport
+	spool     *router.Spool
 }
 
 // Stream sends log data to a connection
 func (a *Adapter) Stream(logstream chan *router.Message) {
-	for message := range logstream {
-		buf := new(bytes.Buffer)
-		err := a.tmpl.Execute(buf, message)
-		if err != nil {
-			log.Println("raw:", err)
-			return
-		}
-		_, err = a.conn.Write(buf.Bytes())
-		if err != nil {
-			log.Println("raw:", err)
-			if _, ok := a.conn.(*net.UDPConn); !ok {
+	var flush <-chan time.Time
+	if a.spool != nil {
+		// replay what was left spooled by a previous run
+		a.flushSpool()
+		ticker := time.NewTicker(router.SpoolFlushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	for {
+		select {
+		case message, ok := <-logstream:
+			if !ok {
+				return
+			}
+			buf := new(bytes.Buffer)
+			err := a.tmpl.Execute(buf, message)
+			if err != nil {
+				log.Println("raw:", err)
 				return
 			}
+			if !a.write(message, buf.Bytes()) {
+				return
+			}
+		case <-flush:
+			a.flushSpool()
 		}
 	}
 }
+
+// write sends a message to the connection, or the spool while it is unreachable.
+// It returns false when the stream can't go on.
+func (a *Adapter) write(message *router.Message, buf []byte) bool {
+	// keep messages in order while spooled ones are waiting to be replayed
+	if a.spool != nil && (a.conn == nil || !a.spool.Empty()) {
+		a.spoolWrite(message, buf)
+		return true
+	}
+	_, err := a.conn.Write(buf)
+	if err == nil {
+		a.route.MarkWritten(message)
+		return true
+	}
+	log.Println("raw:", err)
+	a.route.CountWriteError()
+	if _, ok := a.conn.(*net.UDPConn); ok {
+		return true
+	}
+	if a.spool == nil {
+		return false
+	}
+	log.Println("raw: spooling to disk until reconnected")
+	a.spoolWrite(message, buf)
+	return true
+}
+
+func (a *Adapter) spoolWrite(message *router.Message, buf []byte) {
+	if err := a.spool.Append(buf); err != nil {
+		log.Println("raw: spool:", err)
+		return
+	}
+	a.route.MarkDelivered(message)
+}
+
+func (a *Adapter) flushSpool() {
+	if a.conn != nil && a.spool.Empty() {
+		return
+	}
+	conn, err := a.spool.Replay(a.transport, a.route.Address, a.route.Options)
+	if err != nil {
+		log.Println("raw: spool replay:", err)
+		return
+	}
+	if a.conn != nil {
+		a.conn.Close()
+	}
+	a.conn = conn
+	a.route.CountReconnect()
+	a.route.MarkWritten()
+	log.Println("raw: reconnected, spool replayed")
+}
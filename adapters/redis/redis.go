@@ -0,0 +1,264 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	// ListType pushes messages to lists with RPUSH
+	ListType = "list"
+	// StreamType appends messages to streams with XADD
+	StreamType = "stream"
+
+	defaultKey           = "logspout"
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	replyTimeout         = 30 * time.Second
+)
+
+var hostname string
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewRedisAdapter, "redis")
+	router.SecretOptions("redis.password")
+}
+
+// NewRedisAdapter returns a configured redis.Adapter
+func NewRedisAdapter(route *router.Route) (router.LogAdapter, error) {
+	transport, found := router.AdapterTransports.Lookup(route.AdapterTransport("tcp"))
+	if !found {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	a := &Adapter{
+		route:     route,
+		transport: transport,
+		keyType:   route.Options["redis.type"],
+		username:  route.Options["redis.username"],
+		password:  route.Options["redis.password"],
+	}
+	if a.username == "" {
+		a.username = cfg.GetEnvDefault("REDIS_USERNAME", "")
+		// redis also authenticates with a password alone
+		if a.password == "" {
+			a.password = cfg.GetEnvDefault("REDIS_PASSWORD", "")
+		}
+	}
+	switch a.keyType {
+	case "":
+		a.keyType = ListType
+	case ListType, StreamType:
+	default:
+		return nil, errors.New("bad redis.type: " + a.keyType)
+	}
+	key := route.Options["redis.key"]
+	if key == "" {
+		key = defaultKey
+	}
+	var err error
+	if a.key, err = template.New("key").Parse(key); err != nil {
+		return nil, errors.New("bad redis.key: " + err.Error())
+	}
+	if a.db, err = route.IntOption("redis.db", 0); err != nil {
+		return nil, err
+	}
+	if a.maxLen, err = route.IntOption("redis.maxlen", 0); err != nil {
+		return nil, err
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	if err = a.connect(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Adapter pushes log messages to Redis lists or streams
+type Adapter struct {
+	route         *router.Route
+	transport     router.AdapterTransport
+	conn          net.Conn
+	reader        *bufio.Reader
+	keyType       string
+	key           *template.Template
+	username      string
+	password      string
+	db            int
+	maxLen        int
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// connect dials Redis, authenticating and selecting the database of the route
+func (a *Adapter) connect() error {
+	conn, err := a.transport.Dial(a.route.Address, a.route.Options)
+	if err != nil {
+		return err
+	}
+	var cmds []byte
+	n := 0
+	if a.password != "" {
+		if a.username != "" {
+			cmds = appendCommand(cmds, "AUTH", a.username, a.password)
+		} else {
+			cmds = appendCommand(cmds, "AUTH", a.password)
+		}
+		n++
+	}
+	if a.db > 0 {
+		cmds = appendCommand(cmds, "SELECT", strconv.Itoa(a.db))
+		n++
+	}
+	a.conn = conn
+	a.reader = bufio.NewReader(conn)
+	if err := a.do(cmds, n); err != nil {
+		a.close()
+		return err
+	}
+	return nil
+}
+
+func (a *Adapter) close() {
+	a.conn.Close()
+	a.conn = nil
+}
+
+// do writes pipelined commands and reads their n replies
+func (a *Adapter) do(cmds []byte, n int) error {
+	if n == 0 {
+		return nil
+	}
+	if err := a.conn.SetDeadline(time.Now().Add(replyTimeout)); err != nil {
+		return err
+	}
+	if _, err := a.conn.Write(cmds); err != nil {
+		return err
+	}
+	var replyErr error
+	for i := 0; i < n; i++ {
+		_, err := readReply(a.reader)
+		if _, ok := err.(replyError); ok {
+			replyErr = err
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return replyErr
+}
+
+// Stream pushes batches of log messages with pipelined commands
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	var cmds []byte
+	n := 0
+	for _, message := range batch {
+		cmd, err := a.command(message)
+		if err != nil {
+			log.Println("redis:", err)
+			continue
+		}
+		cmds = append(cmds, cmd...)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	err := a.route.Retry(a.retries, func() error {
+		return a.send(cmds, n)
+	}, batch...)
+	if err != nil {
+		log.Printf("redis: dropping %d messages: %v", n, err)
+		a.route.CountWriteError()
+	}
+}
+
+// send writes commands, reconnecting first after a failure. Error replies,
+// like WRONGTYPE for a key of another type, are not retried since the
+// other commands of the pipeline succeeded.
+func (a *Adapter) send(cmds []byte, n int) error {
+	if a.conn == nil {
+		if err := a.connect(); err != nil {
+			return err
+		}
+	}
+	err := a.do(cmds, n)
+	if _, ok := err.(replyError); ok {
+		return router.Permanent(err)
+	}
+	if err != nil {
+		a.close()
+	}
+	return err
+}
+
+// command returns the RPUSH or XADD command of a message
+func (a *Adapter) command(message *router.Message) ([]byte, error) {
+	var key bytes.Buffer
+	if err := a.key.Execute(&key, &Message{message}); err != nil {
+		return nil, err
+	}
+	record := router.NewRecord(message, hostname)
+	if a.keyType == ListType {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		return appendCommand(nil, "RPUSH", key.String(), string(value)), nil
+	}
+	args := []string{"XADD", key.String()}
+	if a.maxLen > 0 {
+		args = append(args, "MAXLEN", "~", strconv.Itoa(a.maxLen))
+	}
+	args = append(args, "*",
+		"time", record.Time.Format(time.RFC3339Nano),
+		"message", record.Message,
+		"source", record.Source,
+		"host", record.Host)
+	if c := record.Container; c != nil {
+		args = append(args, "container_id", c.ID, "container_name", c.Name, "image", c.Image)
+	}
+	if len(record.Fields) > 0 {
+		fields, err := json.Marshal(record.Fields)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "fields", string(fields))
+	}
+	return appendCommand(nil, args...), nil
+}
+
+// Message extends router.Message for key templates
+type Message struct {
+	*router.Message
+}
+
+// ContainerName returns the message's container name
+func (m *Message) ContainerName() string {
+	if m.Container == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Container.Name, "/")
+}
@@ -0,0 +1,237 @@
+package redis
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	_ "github.com/gliderlabs/logspout/transports/tcp"
+)
+
+var container = &docker.Container{
+	ID:     "8dfafdbc3a40",
+	Name:   "/web",
+	Config: &docker.Config{Image: "nginx:1.21"},
+}
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+}
+
+// readCommand reads a command sent by the adapter
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimPrefix(line, "*"))
+	args := make([]string, n)
+	for i := range args {
+		if args[i], err = readReply(r); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// startServer runs a fake Redis server sending the commands it reads to
+// commands, replying with reply. It closes the first connection after
+// closeAfter commands when closeAfter isn't 0.
+func startServer(t *testing.T, commands chan<- []string, reply func(args []string) string, closeAfter int) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(c)
+			for i := 1; ; i++ {
+				args, err := readCommand(r)
+				if err != nil {
+					break
+				}
+				if i == closeAfter {
+					closeAfter = 0
+					break
+				}
+				commands <- args
+				c.Write([]byte(reply(args)))
+			}
+			c.Close()
+		}
+	}()
+	return l
+}
+
+func ok(args []string) string {
+	switch args[0] {
+	case "RPUSH":
+		return ":1\r\n"
+	case "XADD":
+		return "$15\r\n1500000000000-0\r\n"
+	}
+	return "+OK\r\n"
+}
+
+func newTestAdapter(t *testing.T, l net.Listener, options map[string]string) *Adapter {
+	route := &router.Route{Adapter: "redis", Address: l.Addr().String(), Options: options}
+	adapter, err := NewRedisAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter.(*Adapter)
+}
+
+func TestRedisList(t *testing.T) {
+	commands := make(chan []string, 10)
+	l := startServer(t, commands, ok, 0)
+	defer l.Close()
+	adapter := newTestAdapter(t, l, map[string]string{
+		"redis.key":      "logs:{{.ContainerName}}",
+		"redis.password": "secret",
+		"redis.db":       "2",
+	})
+	if cmd := <-commands; !reflect.DeepEqual(cmd, []string{"AUTH", "secret"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+	if cmd := <-commands; !reflect.DeepEqual(cmd, []string{"SELECT", "2"}) {
+		t.Errorf("unexpected command %v", cmd)
+	}
+
+	adapter.flush([]*router.Message{
+		{Container: container, Source: "stdout", Data: "one", Time: time.Now()},
+		{Container: container, Source: "stderr", Data: "two", Time: time.Now()},
+	})
+	for _, data := range []string{"one", "two"} {
+		cmd := <-commands
+		if cmd[0] != "RPUSH" || cmd[1] != "logs:web" {
+			t.Fatalf("unexpected command %v", cmd)
+		}
+		var record router.Record
+		if err := json.Unmarshal([]byte(cmd[2]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Message != data || record.Container.Name != "web" || record.Container.Image != "nginx:1.21" {
+			t.Errorf("unexpected record %v", record)
+		}
+	}
+}
+
+func TestRedisStream(t *testing.T) {
+	commands := make(chan []string, 10)
+	l := startServer(t, commands, ok, 0)
+	defer l.Close()
+	adapter := newTestAdapter(t, l, map[string]string{"redis.type": "stream", "redis.maxlen": "1000"})
+	now := time.Unix(1500000000, 0).UTC()
+	adapter.flush([]*router.Message{{
+		Container: container,
+		Source:    "stdout",
+		Data:      "hello",
+		Time:      now,
+		Fields:    map[string]interface{}{"level": "info"},
+	}})
+
+	expected := []string{
+		"XADD", "logspout", "MAXLEN", "~", "1000", "*",
+		"time", "2017-07-14T02:40:00Z",
+		"message", "hello",
+		"source", "stdout",
+		"host", hostname,
+		"container_id", "8dfafdbc3a40",
+		"container_name", "web",
+		"image", "nginx:1.21",
+		"fields", `{"level":"info"}`,
+	}
+	if cmd := <-commands; !reflect.DeepEqual(cmd, expected) {
+		t.Errorf("expected %v got %v", expected, cmd)
+	}
+}
+
+func TestRedisReconnect(t *testing.T) {
+	commands := make(chan []string, 10)
+	// the connection is closed on the second command, without a reply
+	l := startServer(t, commands, ok, 2)
+	defer l.Close()
+	adapter := newTestAdapter(t, l, nil)
+	adapter.flush([]*router.Message{{Data: "one"}})
+	adapter.flush([]*router.Message{{Data: "two"}})
+
+	for _, data := range []string{"one", "two"} {
+		cmd := <-commands
+		var record router.Record
+		if err := json.Unmarshal([]byte(cmd[2]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Message != data {
+			t.Errorf("expected message %s got %s", data, record.Message)
+		}
+	}
+}
+
+func TestRedisErrorReply(t *testing.T) {
+	commands := make(chan []string, 10)
+	l := startServer(t, commands, func(args []string) string {
+		return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	}, 0)
+	defer l.Close()
+	adapter := newTestAdapter(t, l, nil)
+	err := adapter.send(appendCommand(nil, "RPUSH", "logspout", "one"), 1)
+	if !router.IsPermanent(err) || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Errorf("expected permanent WRONGTYPE error, got %v", err)
+	}
+	if adapter.conn == nil {
+		t.Error("expected connection to be kept after an error reply")
+	}
+}
+
+func TestRedisBadOptions(t *testing.T) {
+	for _, opts := range []map[string]string{
+		{"redis.type": "set"},
+		{"redis.key": "{{"},
+		{"redis.maxlen": "-1"},
+		{"redis.db": "one"},
+	} {
+		route := &router.Route{Adapter: "redis", Address: "127.0.0.1:6379", Options: opts}
+		if _, err := NewRedisAdapter(route); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
+
+func TestRedisCredentials(t *testing.T) {
+	os.Setenv("REDIS_USERNAME", "env")
+	os.Setenv("REDIS_PASSWORD", "envsecret")
+	defer os.Unsetenv("REDIS_USERNAME")
+	defer os.Unsetenv("REDIS_PASSWORD")
+	l := startServer(t, make(chan []string, 10), ok, 0)
+	defer l.Close()
+	for _, c := range []struct {
+		opts     map[string]string
+		username string
+		password string
+	}{
+		{map[string]string{}, "env", "envsecret"},
+		{map[string]string{"redis.password": "secret"}, "env", "secret"},
+		{map[string]string{"redis.username": "user", "redis.password": "secret"}, "user", "secret"},
+		{map[string]string{"redis.username": "user"}, "user", ""},
+	} {
+		a := newTestAdapter(t, l, c.opts)
+		a.close()
+		if a.username != c.username || a.password != c.password {
+			t.Errorf("expected %s:%s for options %v got %s:%s", c.username, c.password, c.opts, a.username, a.password)
+		}
+	}
+}
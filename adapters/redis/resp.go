@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// The RESP protocol of Redis commands and replies:
+// https://redis.io/docs/reference/protocol-spec/
+
+// appendCommand appends a command as an array of bulk strings
+func appendCommand(b []byte, args ...string) []byte {
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(len(args)), 10)
+	b = append(b, '\r', '\n')
+	for _, arg := range args {
+		b = append(b, '$')
+		b = strconv.AppendInt(b, int64(len(arg)), 10)
+		b = append(b, '\r', '\n')
+		b = append(b, arg...)
+		b = append(b, '\r', '\n')
+	}
+	return b
+}
+
+// replyError is an error reply of Redis, like WRONGTYPE or NOAUTH
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+// readReply reads a reply, returning the value of simple strings, integers
+// and bulk strings, and a replyError for error replies. Arrays are skipped.
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return "", err
+	}
+	if len(line) == 0 {
+		return "", errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", replyError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", errors.New("redis: bad reply: " + line)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", errors.New("redis: bad reply: " + line)
+		}
+		for i := 0; i < n; i++ {
+			if _, err := readReply(r); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+	return "", errors.New("redis: bad reply: " + line)
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("redis: bad reply: " + line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,291 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	defaultKey     = "logs/{{.Date}}/{{.Hostname}}/{{.ContainerName}}-{{.Seq}}.json.gz"
+	defaultRegion  = "us-east-1"
+	defaultMaxSize = 100 << 20
+	defaultMaxAge  = 5 * time.Minute
+
+	tickInterval   = 10 * time.Second
+	requestTimeout = 5 * time.Minute
+)
+
+var hostname string
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewS3Adapter, "s3")
+	router.SecretOptions("s3.secret_access_key")
+}
+
+// NewS3Adapter returns a configured s3.Adapter
+func NewS3Adapter(route *router.Route) (router.LogAdapter, error) {
+	if route.AdapterTransport("") != "" {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	if route.Address == "" || strings.Contains(route.Address, "/") {
+		return nil, errors.New("bad bucket: " + route.Address)
+	}
+	a := &Adapter{
+		route:        route,
+		bucket:       route.Address,
+		client:       &http.Client{Timeout: requestTimeout},
+		region:       route.Options["s3.region"],
+		pathStyle:    route.Options["s3.path_style"] == "true",
+		storageClass: route.Options["s3.storage_class"],
+		objects:      make(map[string]*object),
+		lastSeq:      make(map[string]int64),
+		creds: credentials{
+			accessKeyID:     route.Options["s3.access_key_id"],
+			secretAccessKey: route.Options["s3.secret_access_key"],
+		},
+	}
+	if a.region == "" {
+		a.region = cfg.GetEnvDefault("AWS_REGION", defaultRegion)
+	}
+	if a.creds.accessKeyID == "" {
+		a.creds = credentials{
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if a.creds.accessKeyID == "" || a.creds.secretAccessKey == "" {
+		return nil, errors.New("bad s3 credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	endpoint := route.Options["s3.endpoint"]
+	if endpoint == "" {
+		endpoint = cfg.GetEnvDefault("S3_ENDPOINT", "https://s3."+a.region+".amazonaws.com")
+	}
+	var err error
+	if a.endpoint, err = url.Parse(strings.TrimSuffix(endpoint, "/")); err != nil || a.endpoint.Host == "" ||
+		(a.endpoint.Scheme != "http" && a.endpoint.Scheme != "https") {
+		return nil, errors.New("bad s3.endpoint: " + endpoint)
+	}
+	key := route.Options["s3.key"]
+	if key == "" {
+		key = defaultKey
+	}
+	if a.key, err = template.New("key").Parse(key); err != nil {
+		return nil, errors.New("bad s3.key: " + err.Error())
+	}
+	if a.maxSize, err = route.SizeOption("s3.max_size", defaultMaxSize); err != nil {
+		return nil, err
+	}
+	if a.maxAge, err = route.DurationOption("s3.max_age", defaultMaxAge); err != nil {
+		return nil, err
+	}
+	if a.maxSize <= 0 || a.maxAge <= 0 {
+		return nil, errors.New("bad s3.max_size or s3.max_age: objects must be uploaded")
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Adapter archives log messages to S3 compatible object storage, as gzipped
+// NDJSON objects of the messages of each container
+type Adapter struct {
+	route        *router.Route
+	client       *http.Client
+	endpoint     *url.URL
+	bucket       string
+	region       string
+	pathStyle    bool
+	storageClass string
+	creds        credentials
+	key          *template.Template
+	maxSize      int64
+	maxAge       time.Duration
+	retries      int
+	objects      map[string]*object
+	lastSeq      map[string]int64
+}
+
+// object is an object being filled with the messages of a container
+type object struct {
+	container *docker.Container
+	started   time.Time
+	seq       int64
+	size      int64
+	count     int
+	last      *router.Message // the object's messages are delivered up to it
+	buf       bytes.Buffer
+	gz        *gzip.Writer
+}
+
+// Stream archives log messages, uploading the object of a container once
+// it reaches s3.max_size or s3.max_age
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	interval := tickInterval
+	if a.maxAge < interval {
+		interval = a.maxAge
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-logstream:
+			if !ok {
+				for id, obj := range a.objects {
+					a.upload(id, obj)
+				}
+				return
+			}
+			if err := a.write(message, time.Now()); err != nil {
+				log.Println("s3:", err)
+			}
+		case now := <-ticker.C:
+			for id, obj := range a.objects {
+				if now.Sub(obj.started) >= a.maxAge {
+					a.upload(id, obj)
+				}
+			}
+		}
+	}
+}
+
+func (a *Adapter) write(message *router.Message, now time.Time) error {
+	line, err := json.Marshal(router.NewRecord(message, hostname))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	id := ""
+	if message.Container != nil {
+		id = message.Container.ID
+	}
+	obj, ok := a.objects[id]
+	if !ok {
+		obj = &object{container: message.Container, started: now, seq: a.nextSeq(id, now)}
+		obj.gz = gzip.NewWriter(&obj.buf)
+		a.objects[id] = obj
+	}
+	if _, err := obj.gz.Write(line); err != nil {
+		return err
+	}
+	obj.size += int64(len(line))
+	obj.count++
+	obj.last = message
+	if obj.size >= a.maxSize {
+		a.upload(id, obj)
+	}
+	return nil
+}
+
+// nextSeq returns the sequence number of a new object of a container: the
+// time it started in milliseconds, so sequence numbers increase across
+// restarts of logspout, made greater than that of the previous object
+func (a *Adapter) nextSeq(id string, now time.Time) int64 {
+	seq := now.UnixNano() / int64(time.Millisecond)
+	if last, ok := a.lastSeq[id]; ok && seq <= last {
+		seq = last + 1
+	}
+	a.lastSeq[id] = seq
+	return seq
+}
+
+// upload uploads the object of a container, forgetting it whether it was
+// uploaded or dropped after failing
+func (a *Adapter) upload(id string, obj *object) {
+	delete(a.objects, id)
+	if err := obj.gz.Close(); err != nil {
+		log.Printf("s3: dropping %d messages: %v", obj.count, err)
+		a.route.CountWriteError()
+		return
+	}
+	var key bytes.Buffer
+	if err := a.key.Execute(&key, newKeyData(obj)); err != nil {
+		log.Printf("s3: dropping %d messages: %v", obj.count, err)
+		a.route.CountWriteError()
+		return
+	}
+	err := a.route.Retry(a.retries, func() error {
+		return a.put(strings.TrimPrefix(key.String(), "/"), obj.buf.Bytes())
+	}, obj.last)
+	if err != nil {
+		log.Printf("s3: dropping %d messages: %v", obj.count, err)
+		a.route.CountWriteError()
+	}
+}
+
+// objectURL returns the URL of an object, with the bucket in the path for
+// path-style addressing, or in the host otherwise
+func (a *Adapter) objectURL(key string) *url.URL {
+	u := *a.endpoint
+	path := u.Path + "/" + key
+	if a.pathStyle {
+		path = u.Path + "/" + a.bucket + "/" + key
+	} else {
+		u.Host = a.bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = escapePath(path)
+	return &u
+}
+
+func (a *Adapter) put(key string, body []byte) error {
+	req, err := http.NewRequest("PUT", a.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return router.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("X-Amz-Content-Sha256", hashHex(body))
+	if a.storageClass != "" {
+		req.Header.Set("X-Amz-Storage-Class", a.storageClass)
+	}
+	sign(req, hashHex(body), a.creds, a.region, "s3", time.Now())
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return router.CheckHTTPResponse(resp)
+}
+
+// KeyData is the data of s3.key templates
+type KeyData struct {
+	Time          time.Time
+	Date          string
+	Hostname      string
+	ContainerID   string
+	ContainerName string
+	Container     *docker.Container
+	Seq           int64
+}
+
+func newKeyData(obj *object) *KeyData {
+	started := obj.started.UTC()
+	data := &KeyData{
+		Time:      started,
+		Date:      started.Format("2006-01-02"),
+		Hostname:  hostname,
+		Container: obj.container,
+		Seq:       obj.seq,
+	}
+	if obj.container != nil {
+		data.ContainerID = obj.container.ID
+		data.ContainerName = strings.TrimPrefix(obj.container.Name, "/")
+	}
+	return data
+}
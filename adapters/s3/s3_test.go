@@ -0,0 +1,228 @@
+package s3
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+)
+
+var (
+	web = &docker.Container{
+		ID:     "8dfafdbc3a40",
+		Name:   "/web",
+		Config: &docker.Config{Image: "nginx:1.21"},
+	}
+	db = &docker.Container{
+		ID:     "d9e6a2fc1b74",
+		Name:   "/db",
+		Config: &docker.Config{Image: "postgres:13"},
+	}
+)
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+}
+
+type upload struct {
+	path    string
+	header  http.Header
+	records []router.Record
+}
+
+// newTestServer runs a fake S3 server sending the objects uploaded to uploads
+func newTestServer(t *testing.T, uploads chan<- upload) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") != hashHex(body) {
+			t.Error("unexpected payload hash")
+		}
+		gz, err := gzip.NewReader(strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := upload{path: r.URL.EscapedPath(), header: r.Header}
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			var record router.Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+			u.records = append(u.records, record)
+		}
+		uploads <- u
+	}))
+}
+
+func newAdapter(t *testing.T, srv *httptest.Server, options map[string]string) *Adapter {
+	options["s3.endpoint"] = srv.URL
+	options["s3.path_style"] = "true"
+	options["s3.access_key_id"] = "AKIDEXAMPLE"
+	options["s3.secret_access_key"] = "secret"
+	adapter, err := NewS3Adapter(&router.Route{Adapter: "s3", Address: "logs", Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter.(*Adapter)
+}
+
+func TestSignature(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds := credentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	sign(req, hashHex(nil), creds, "us-east-1", "service", now)
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Errorf("expected %s\ngot %s", expected, auth)
+	}
+}
+
+func TestObjectURL(t *testing.T) {
+	route := &router.Route{Adapter: "s3", Address: "logs", Options: map[string]string{
+		"s3.region":            "eu-west-1",
+		"s3.access_key_id":     "AKIDEXAMPLE",
+		"s3.secret_access_key": "secret",
+	}}
+	adapter, err := NewS3Adapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := adapter.(*Adapter).objectURL("logs/web 1+2.json.gz")
+	if s := u.String(); s != "https://logs.s3.eu-west-1.amazonaws.com/logs/web%201%2B2.json.gz" {
+		t.Errorf("unexpected url %s", s)
+	}
+}
+
+func TestUploadBySize(t *testing.T) {
+	uploads := make(chan upload, 10)
+	srv := newTestServer(t, uploads)
+	defer srv.Close()
+
+	a := newAdapter(t, srv, map[string]string{"s3.max_size": "100"})
+	now := time.Date(2021, 12, 3, 10, 0, 0, 0, time.UTC)
+	routertest.Stream(a,
+		&router.Message{Container: web, Source: "stdout", Data: "one", Time: now},
+		&router.Message{Container: web, Source: "stdout", Data: "two", Time: now},
+		&router.Message{Container: db, Source: "stderr", Data: "three", Time: now},
+	)
+	close(uploads)
+
+	var web, db []upload
+	for u := range uploads {
+		if strings.Contains(u.path, "/web-") {
+			web = append(web, u)
+		} else {
+			db = append(db, u)
+		}
+	}
+	if len(web) != 2 || len(db) != 1 {
+		t.Fatalf("expected 2 objects for web and 1 for db, got %d and %d", len(web), len(db))
+	}
+	key := regexp.MustCompile(`^/logs/logs/\d{4}-\d{2}-\d{2}/` + regexp.QuoteMeta(hostname) + `/web-(\d+)\.json\.gz$`)
+	first, second := key.FindStringSubmatch(web[0].path), key.FindStringSubmatch(web[1].path)
+	if first == nil || second == nil {
+		t.Fatalf("unexpected keys %s and %s", web[0].path, web[1].path)
+	}
+	seq1, _ := strconv.ParseInt(first[1], 10, 64)
+	seq2, _ := strconv.ParseInt(second[1], 10, 64)
+	if seq2 <= seq1 {
+		t.Errorf("expected increasing sequence numbers, got %s and %s", first[1], second[1])
+	}
+	if len(web[0].records) != 1 || web[0].records[0].Message != "one" || web[1].records[0].Message != "two" {
+		t.Errorf("unexpected records %v and %v", web[0].records, web[1].records)
+	}
+	if db[0].records[0].Source != "stderr" || db[0].records[0].Container.Image != "postgres:13" {
+		t.Errorf("unexpected record %v", db[0].records[0])
+	}
+	if auth := web[0].header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+		!strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		t.Errorf("unexpected authorization %s", auth)
+	}
+}
+
+func TestUploadByAge(t *testing.T) {
+	uploads := make(chan upload, 10)
+	srv := newTestServer(t, uploads)
+	defer srv.Close()
+
+	a := newAdapter(t, srv, map[string]string{
+		"s3.max_age": "20ms",
+		"s3.key":     "{{.Time.Format \"2006/01/02\"}}/{{.ContainerID}}.ndjson.gz",
+	})
+	stream := make(chan *router.Message, 2)
+	done := make(chan struct{})
+	go func() {
+		a.Stream(stream)
+		close(done)
+	}()
+	stream <- &router.Message{Container: web, Data: "one", Time: time.Now()}
+	stream <- &router.Message{Container: web, Data: "two", Time: time.Now()}
+
+	select {
+	case u := <-uploads:
+		if !strings.HasSuffix(u.path, "/"+web.ID+".ndjson.gz") || len(u.records) != 2 {
+			t.Errorf("unexpected upload of %d records to %s", len(u.records), u.path)
+		}
+	case <-time.After(time.Second):
+		t.Error("timeout waiting for upload")
+	}
+	close(stream)
+	<-done
+	if len(uploads) != 0 {
+		t.Error("expected no empty object to be uploaded")
+	}
+}
+
+func TestUploadRetry(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	a := newAdapter(t, srv, map[string]string{})
+	routertest.Stream(a, &router.Message{Container: web, Data: "one", Time: time.Now()})
+	if attempts != 2 {
+		t.Errorf("expected the upload to be retried once, got %d attempts", attempts)
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	creds := func(options map[string]string) map[string]string {
+		options["s3.access_key_id"] = "AKIDEXAMPLE"
+		options["s3.secret_access_key"] = "secret"
+		return options
+	}
+	for _, route := range []*router.Route{
+		{Adapter: "s3+tcp", Address: "logs", Options: creds(map[string]string{})},
+		{Adapter: "s3", Address: "logs/archive", Options: creds(map[string]string{})},
+		{Adapter: "s3", Address: "logs", Options: creds(map[string]string{"s3.endpoint": "minio:9000"})},
+		{Adapter: "s3", Address: "logs", Options: creds(map[string]string{"s3.key": "{{"})},
+		{Adapter: "s3", Address: "logs", Options: creds(map[string]string{"s3.max_age": "0"})},
+		{Adapter: "s3", Address: "logs", Options: creds(map[string]string{"s3.max_size": "big"})},
+	} {
+		if _, err := NewS3Adapter(route); err == nil {
+			t.Errorf("expected error for route %v", route)
+		}
+	}
+}
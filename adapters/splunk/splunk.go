@@ -0,0 +1,437 @@
+package splunk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	eventPath = "/services/collector/event"
+	ackPath   = "/services/collector/ack"
+
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	defaultAckTimeout    = time.Minute
+	requestTimeout       = 30 * time.Second
+)
+
+var (
+	hostname string
+
+	// ackPollInterval is how often the status of acknowledgements is polled
+	ackPollInterval = time.Second
+)
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewSplunkAdapter, "splunk")
+	router.SecretOptions("splunk.token")
+}
+
+// NewSplunkAdapter returns a configured splunk.Adapter
+func NewSplunkAdapter(route *router.Route) (router.LogAdapter, error) {
+	scheme := route.AdapterTransport("http")
+	if scheme != "http" && scheme != "https" {
+		return nil, errors.New("bad transport: " + route.Adapter)
+	}
+	base := scheme + "://" + strings.TrimSuffix(route.Address+route.Path, "/")
+	a := &Adapter{
+		route:    route,
+		eventURL: base + eventPath,
+		ackURL:   base + ackPath,
+		client:   &http.Client{Timeout: requestTimeout},
+		token:    route.Options["splunk.token"],
+		ack:      route.Options["splunk.ack"] == "true",
+		pending:  make(map[int64]*pendingBatch),
+	}
+	if a.token == "" {
+		a.token = cfg.GetEnvDefault("SPLUNK_TOKEN", "")
+	}
+	if a.token == "" {
+		return nil, errors.New("bad splunk.token: a HEC token is required")
+	}
+	var err error
+	for _, t := range []struct {
+		tmpl **template.Template
+		name string
+	}{
+		{&a.index, "index"},
+		{&a.sourcetype, "sourcetype"},
+		{&a.source, "source"},
+		{&a.tmpl, "template"},
+	} {
+		if s := route.Options["splunk."+t.name]; s != "" {
+			if *t.tmpl, err = template.New(t.name).Parse(s); err != nil {
+				return nil, fmt.Errorf("bad splunk.%s: %v", t.name, err)
+			}
+		}
+	}
+	if a.ackTimeout, err = route.DurationOption("splunk.ack_timeout", defaultAckTimeout); err != nil {
+		return nil, err
+	}
+	if a.ack {
+		// acknowledgements are tracked per channel, which identifies the
+		// client sending the events
+		if a.channel, err = newChannel(); err != nil {
+			return nil, err
+		}
+	}
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newChannel returns a random UUID identifying a HEC channel
+func newChannel() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// Adapter sends log messages to the HTTP Event Collector of Splunk
+type Adapter struct {
+	route         *router.Route
+	eventURL      string
+	ackURL        string
+	client        *http.Client
+	token         string
+	channel       string
+	ack           bool
+	ackTimeout    time.Duration
+	index         *template.Template
+	sourcetype    *template.Template
+	source        *template.Template
+	tmpl          *template.Template
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+
+	mu      sync.Mutex
+	pending map[int64]*pendingBatch // by ack id
+}
+
+// pendingBatch is a batch of events sent to the collector, waiting for its
+// acknowledgement
+type pendingBatch struct {
+	body     []byte
+	messages []*router.Message
+	deadline time.Time
+	resends  int
+}
+
+// Stream sends batches of log messages. With acknowledgements, it keeps
+// sending batches while their acknowledgements are polled, and returns once
+// logstream is closed and none are pending.
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	if !a.ack {
+		router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+		return
+	}
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		a.trackAcks(closed)
+		close(done)
+	}()
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+	close(closed)
+	<-done
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, message := range batch {
+		event, err := a.newEvent(message)
+		if err == nil {
+			err = enc.Encode(event)
+		}
+		if err != nil {
+			log.Println("splunk:", err)
+		}
+	}
+	if body.Len() == 0 {
+		return
+	}
+	a.deliver(&pendingBatch{body: body.Bytes(), messages: batch})
+}
+
+// deliver sends a batch, adding it to the pending batches when
+// acknowledgements are enabled. Those batches are only written once
+// acknowledged.
+func (a *Adapter) deliver(batch *pendingBatch) {
+	if !a.ack {
+		err := a.route.Retry(a.retries, func() error {
+			_, err := a.send(batch.body)
+			return err
+		}, batch.messages...)
+		if err != nil {
+			a.drop(batch, err)
+		}
+		return
+	}
+	tries := 0
+	err := router.Retry(a.retries, func() error {
+		if tries++; tries > 1 {
+			a.route.CountRetry()
+		}
+		ackID, err := a.send(batch.body)
+		if err == nil {
+			a.mu.Lock()
+			batch.deadline = time.Now().Add(a.ackTimeout)
+			a.pending[ackID] = batch
+			a.mu.Unlock()
+		}
+		return err
+	})
+	if err != nil {
+		a.drop(batch, err)
+	}
+}
+
+func (a *Adapter) drop(batch *pendingBatch, err error) {
+	log.Printf("splunk: dropping %d messages: %v", len(batch.messages), err)
+	a.route.CountWriteError()
+}
+
+// response is the response of the collector to events, with the id of their
+// acknowledgement when they are enabled
+type response struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+// send posts events to the collector, returning the id of their acknowledgement
+func (a *Adapter) send(body []byte) (int64, error) {
+	resp, err := a.post(a.eventURL, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := router.CheckHTTPResponse(resp); err != nil {
+		return 0, err
+	}
+	if !a.ack {
+		return 0, nil
+	}
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return 0, err
+	}
+	if r.AckID == nil {
+		return 0, router.Permanent(errors.New("no ackId in response, indexer acknowledgement is disabled for the token"))
+	}
+	return *r.AckID, nil
+}
+
+// trackAcks polls the status of the pending acknowledgements until closed is
+// closed and none are left
+func (a *Adapter) trackAcks(closed <-chan struct{}) {
+	ticker := time.NewTicker(ackPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.pollAcks()
+		case <-closed:
+			closed = nil
+		}
+		if closed == nil {
+			a.mu.Lock()
+			n := len(a.pending)
+			a.mu.Unlock()
+			if n == 0 {
+				return
+			}
+		}
+	}
+}
+
+// pollAcks polls the status of the pending acknowledgements at once. A batch
+// not acknowledged in time is sent again, as Splunk may have lost it before
+// indexing it.
+func (a *Adapter) pollAcks() {
+	a.mu.Lock()
+	ids := make([]int64, 0, len(a.pending))
+	for id := range a.pending {
+		ids = append(ids, id)
+	}
+	a.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+	acks, err := a.pollAck(ids)
+	if router.IsPermanent(err) {
+		a.mu.Lock()
+		for _, id := range ids {
+			a.drop(a.pending[id], err)
+			delete(a.pending, id)
+		}
+		a.mu.Unlock()
+		return
+	}
+	if err != nil {
+		// the events may be acknowledged by the next poll
+		log.Println("splunk:", err)
+	}
+	now := time.Now()
+	var acked, unacked []*pendingBatch
+	a.mu.Lock()
+	for _, id := range ids {
+		switch batch := a.pending[id]; {
+		case acks[strconv.FormatInt(id, 10)]:
+			delete(a.pending, id)
+			acked = append(acked, batch)
+		case now.After(batch.deadline):
+			delete(a.pending, id)
+			unacked = append(unacked, batch)
+		}
+	}
+	a.mu.Unlock()
+	for _, batch := range acked {
+		a.route.MarkWritten(batch.messages...)
+	}
+	for _, batch := range unacked {
+		if batch.resends >= a.retries {
+			a.drop(batch, fmt.Errorf("ack not received after %v", a.ackTimeout))
+			continue
+		}
+		batch.resends++
+		a.route.CountRetry()
+		a.deliver(batch)
+	}
+}
+
+// pollAck returns the status of acknowledgements, by id
+func (a *Adapter) pollAck(ids []int64) (map[string]bool, error) {
+	body, _ := json.Marshal(map[string][]int64{"acks": ids})
+	resp, err := a.post(a.ackURL, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := router.CheckHTTPResponse(resp); err != nil {
+		return nil, err
+	}
+	var status struct {
+		Acks map[string]bool `json:"acks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return status.Acks, nil
+}
+
+func (a *Adapter) post(url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, router.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+a.token)
+	if a.channel != "" {
+		req.Header.Set("X-Splunk-Request-Channel", a.channel)
+	}
+	return a.client.Do(req)
+}
+
+// Event is a log message in the format of the HTTP Event Collector
+type Event struct {
+	Time       json.Number `json:"time,omitempty"`
+	Host       string      `json:"host,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Sourcetype string      `json:"sourcetype,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// Record is the event of a log message sent as JSON, without the time and
+// host of the Event
+type Record struct {
+	Message   string                  `json:"message"`
+	Source    string                  `json:"source"`
+	Container *router.RecordContainer `json:"container,omitempty"`
+	Fields    map[string]interface{}  `json:"fields,omitempty"`
+}
+
+// NewRecord returns the record of a log message
+func NewRecord(message *router.Message) *Record {
+	return &Record{
+		Message:   message.Data,
+		Source:    message.Source,
+		Container: router.NewRecordContainer(message.Container),
+		Fields:    message.Fields,
+	}
+}
+
+func (a *Adapter) newEvent(message *router.Message) (*Event, error) {
+	m := &Message{message}
+	event := &Event{Host: hostname}
+	if !message.Time.IsZero() {
+		// seconds since the epoch, with milliseconds
+		event.Time = json.Number(fmt.Sprintf("%d.%03d", message.Time.Unix(), message.Time.Nanosecond()/int(time.Millisecond)))
+	}
+	for _, t := range []struct {
+		tmpl  *template.Template
+		value *string
+	}{
+		{a.index, &event.Index},
+		{a.sourcetype, &event.Sourcetype},
+		{a.source, &event.Source},
+	} {
+		if t.tmpl == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := t.tmpl.Execute(&buf, m); err != nil {
+			return nil, err
+		}
+		*t.value = buf.String()
+	}
+	if a.tmpl != nil {
+		var buf bytes.Buffer
+		if err := a.tmpl.Execute(&buf, m); err != nil {
+			return nil, err
+		}
+		event.Event = buf.String()
+	} else {
+		event.Event = NewRecord(message)
+	}
+	return event, nil
+}
+
+// Message extends router.Message for index, sourcetype, source and event templates
+type Message struct {
+	*router.Message
+}
+
+// ContainerName returns the message's container name
+func (m *Message) ContainerName() string {
+	if m.Container == nil {
+		return ""
+	}
+	return strings.TrimPrefix(m.Container.Name, "/")
+}
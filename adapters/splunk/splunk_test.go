@@ -0,0 +1,233 @@
+package splunk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+)
+
+var container = &docker.Container{
+	ID:   "8dfafdbc3a40",
+	Name: "/shop_web_1",
+	Config: &docker.Config{
+		Image: "nginx:1.21",
+		Labels: map[string]string{
+			"com.docker.compose.service": "web",
+			"com.example.index":          "shop",
+		},
+	},
+}
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+	ackPollInterval = time.Millisecond
+}
+
+// collector is a fake HTTP Event Collector acknowledging events after
+// pending polls of their acknowledgement
+type collector struct {
+	sync.Mutex
+	t        *testing.T
+	ack      bool
+	pending  int
+	events   []*Event
+	channels map[string]bool
+	sent     int64
+	polls    map[int64]int
+	maxAcks  int // most acknowledgements polled at once
+}
+
+func newCollector(t *testing.T, ack bool, pending int) (*collector, *httptest.Server) {
+	c := &collector{t: t, ack: ack, pending: pending, channels: make(map[string]bool), polls: make(map[int64]int)}
+	return c, httptest.NewServer(c)
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+	if auth := r.Header.Get("Authorization"); auth != "Splunk secret" {
+		c.t.Errorf("unexpected authorization %q", auth)
+	}
+	if channel := r.Header.Get("X-Splunk-Request-Channel"); channel != "" {
+		c.channels[channel] = true
+	}
+	switch r.URL.Path {
+	case eventPath:
+		dec := json.NewDecoder(r.Body)
+		for {
+			var event Event
+			if err := dec.Decode(&event); err == io.EOF {
+				break
+			} else if err != nil {
+				c.t.Fatal(err)
+			}
+			c.events = append(c.events, &event)
+		}
+		if !c.ack {
+			fmt.Fprint(w, `{"text":"Success","code":0}`)
+			return
+		}
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, c.sent)
+		c.sent++
+	case ackPath:
+		var req struct {
+			Acks []int64 `json:"acks"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Acks) > c.maxAcks {
+			c.maxAcks = len(req.Acks)
+		}
+		acks := make(map[string]bool)
+		for _, id := range req.Acks {
+			c.polls[id]++
+			acks[fmt.Sprint(id)] = c.polls[id] > c.pending
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"acks": acks})
+	default:
+		c.t.Errorf("unexpected path %s", r.URL.Path)
+	}
+}
+
+func streamMessages(t *testing.T, srv *httptest.Server, options map[string]string, messages ...*router.Message) *router.Route {
+	options["splunk.token"] = "secret"
+	route := &router.Route{Adapter: "splunk", Address: strings.TrimPrefix(srv.URL, "http://"), Options: options}
+	adapter, err := NewSplunkAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routertest.Stream(adapter, messages...)
+	return route
+}
+
+func TestSplunkEvents(t *testing.T) {
+	c, srv := newCollector(t, false, 0)
+	defer srv.Close()
+
+	now := time.Unix(1500000000, 123456789)
+	streamMessages(t, srv, map[string]string{
+		"splunk.index":      "{{index .Container.Config.Labels \"com.example.index\"}}",
+		"splunk.sourcetype": "docker:{{.Source}}",
+		"splunk.source":     "{{.ContainerName}}",
+	}, &router.Message{Container: container, Source: "stdout", Data: "hello", Time: now},
+		&router.Message{Container: container, Source: "stderr", Data: "oops", Time: now})
+
+	if len(c.events) != 2 {
+		t.Fatalf("expected 2 events got %d", len(c.events))
+	}
+	event := c.events[1]
+	if event.Time != "1500000000.123" || event.Index != "shop" || event.Sourcetype != "docker:stderr" || event.Source != "shop_web_1" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	record := event.Event.(map[string]interface{})
+	if record["message"] != "oops" || record["container"].(map[string]interface{})["image"] != "nginx:1.21" {
+		t.Errorf("unexpected record %v", record)
+	}
+	if len(c.channels) != 0 {
+		t.Errorf("expected no channel without acknowledgements, got %v", c.channels)
+	}
+}
+
+func TestSplunkTemplate(t *testing.T) {
+	c, srv := newCollector(t, false, 0)
+	defer srv.Close()
+
+	streamMessages(t, srv, map[string]string{"splunk.template": "{{.ContainerName}}: {{.Data}}"},
+		&router.Message{Container: container, Data: "hello", Time: time.Now()})
+	if len(c.events) != 1 || c.events[0].Event != "shop_web_1: hello" {
+		t.Errorf("unexpected events %v", c.events)
+	}
+	if c.events[0].Index != "" || c.events[0].Sourcetype != "" {
+		t.Errorf("expected the defaults of the token, got %+v", c.events[0])
+	}
+}
+
+func TestSplunkAck(t *testing.T) {
+	c, srv := newCollector(t, true, 2)
+	defer srv.Close()
+
+	route := streamMessages(t, srv, map[string]string{"splunk.ack": "true"},
+		&router.Message{Container: container, Data: "hello", Time: time.Now()})
+	if len(c.events) != 1 {
+		t.Errorf("expected the batch to be sent once, got %d events", len(c.events))
+	}
+	if route.Health().LastWrite == nil {
+		t.Error("expected the acknowledged batch to mark the route written")
+	}
+	if c.polls[0] != 3 {
+		t.Errorf("expected the ack to be polled until acknowledged, got %d polls", c.polls[0])
+	}
+	if len(c.channels) != 1 {
+		t.Errorf("expected a single channel, got %v", c.channels)
+	}
+}
+
+func TestSplunkAckPipelined(t *testing.T) {
+	defer func(interval time.Duration) { ackPollInterval = interval }(ackPollInterval)
+	ackPollInterval = 50 * time.Millisecond
+	c, srv := newCollector(t, true, 1)
+	defer srv.Close()
+
+	streamMessages(t, srv, map[string]string{"splunk.ack": "true", "batch.size": "1"},
+		&router.Message{Container: container, Data: "one", Time: time.Now()},
+		&router.Message{Container: container, Data: "two", Time: time.Now()},
+		&router.Message{Container: container, Data: "three", Time: time.Now()})
+	if len(c.events) != 3 {
+		t.Errorf("expected each batch to be sent once, got %d events", len(c.events))
+	}
+	if c.maxAcks != 3 {
+		t.Errorf("expected the acks of the 3 batches to be polled at once, got at most %d", c.maxAcks)
+	}
+}
+
+func TestSplunkAckTimeout(t *testing.T) {
+	c, srv := newCollector(t, true, 1000)
+	defer srv.Close()
+
+	route := streamMessages(t, srv, map[string]string{"splunk.ack": "true", "splunk.ack_timeout": "5ms", "retry.count": "2"},
+		&router.Message{Container: container, Data: "hello", Time: time.Now()})
+	if len(c.events) != 3 {
+		t.Errorf("expected the unacknowledged batch to be sent 3 times, got %d events", len(c.events))
+	}
+	if route.Health().LastWrite != nil {
+		t.Error("expected the unacknowledged batch not to mark the route written")
+	}
+	if counters := route.Counters(); counters.Retries != 2 || counters.WriteErrors != 1 {
+		t.Errorf("expected 2 retries and 1 write error, got %+v", counters)
+	}
+}
+
+func TestSplunkAckDisabled(t *testing.T) {
+	c, srv := newCollector(t, false, 0)
+	defer srv.Close()
+
+	streamMessages(t, srv, map[string]string{"splunk.ack": "true"},
+		&router.Message{Container: container, Data: "hello", Time: time.Now()})
+	if len(c.events) != 1 {
+		t.Errorf("expected the batch not to be retried without an ackId, got %d events", len(c.events))
+	}
+}
+
+func TestSplunkBadOptions(t *testing.T) {
+	for _, route := range []*router.Route{
+		{Adapter: "splunk+udp", Address: "localhost:8088", Options: map[string]string{"splunk.token": "secret"}},
+		{Adapter: "splunk", Address: "localhost:8088", Options: map[string]string{}},
+		{Adapter: "splunk", Address: "localhost:8088", Options: map[string]string{"splunk.token": "secret", "splunk.index": "{{"}},
+		{Adapter: "splunk", Address: "localhost:8088", Options: map[string]string{"splunk.token": "secret", "splunk.ack_timeout": "1"}},
+		{Adapter: "splunk", Address: "localhost:8088", Options: map[string]string{"splunk.token": "secret", "batch.size": "0"}},
+	} {
+		if _, err := NewSplunkAdapter(route); err == nil {
+			t.Errorf("expected error for route %v", route)
+		}
+	}
+}
@@ -173,10 +173,20 @@ func NewSyslogAdapter(route *router.Route) (router.LogAdapter, error) {
 	if !found {
 		return nil, errors.New("bad transport: " + route.Adapter)
 	}
-	conn, err := transport.Dial(route.Address, route.Options)
+	spool, err := router.OpenSpool(route)
 	if err != nil {
 		return nil, err
 	}
+	conn, err := transport.Dial(route.Address, route.Options)
+	if err != nil {
+		if spool == nil {
+			return nil, err
+		}
+		// spool until the destination can be dialed, rather than failing
+		// the route and losing what was spooled before a restart
+		log.Println("syslog: spooling to disk until reconnected:", err)
+		route.CountWriteError()
+	}
 
 	format, err := getFormat()
 	if err != nil {
@@ -190,6 +200,9 @@ func NewSyslogAdapter(route *router.Route) (router.LogAdapter, error) {
 	}
 
 	connIsTCP := isTCPConnection(conn)
+	if conn == nil {
+		connIsTCP = route.AdapterTransport("udp") != "udp"
+	}
 	debug("setting connIsTCP to:", connIsTCP)
 
 	var tcpFraming TCPFraming
@@ -212,6 +225,7 @@ func NewSyslogAdapter(route *router.Route) (router.LogAdapter, error) {
 		transport:  transport,
 		tcpFraming: tcpFraming,
 		retryCount: retryCount,
+		spool:      spool,
 	}, nil
 }
 
@@ -236,32 +250,95 @@ type Adapter struct {
 	transport  router.AdapterTransport
 	tcpFraming TCPFraming
 	retryCount uint
+	spool      *router.Spool
 }
 
 // Stream sends log data to a connection
 func (a *Adapter) Stream(logstream chan *router.Message) {
-	for message := range logstream {
-		m := &Message{message}
-		buf, err := m.Render(a.format, a.tmpl)
-		if err != nil {
-			log.Println("syslog:", err)
-			return
-		}
+	var flush <-chan time.Time
+	if a.spool != nil {
+		// replay what was left spooled by a previous run
+		a.flushSpool()
+		ticker := time.NewTicker(router.SpoolFlushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	for {
+		select {
+		case message, ok := <-logstream:
+			if !ok {
+				return
+			}
+			m := &Message{message}
+			buf, err := m.Render(a.format, a.tmpl)
+			if err != nil {
+				log.Println("syslog:", err)
+				return
+			}
+
+			if a.connIsTCP && a.tcpFraming == OctetCountedTCPFraming {
+				buf = append([]byte(fmt.Sprintf("%d ", len(buf))), buf...)
+			}
 
-		if a.connIsTCP && a.tcpFraming == OctetCountedTCPFraming {
-			buf = append([]byte(fmt.Sprintf("%d ", len(buf))), buf...)
+			a.write(message, buf)
+		case <-flush:
+			a.flushSpool()
 		}
+	}
+}
 
-		if _, err = a.conn.Write(buf); err != nil {
-			log.Println("syslog:", err)
-			if a.connIsTCP {
-				if err = a.retry(buf, err); err != nil {
-					log.Panicf("syslog retry err: %+v", err)
-					return
-				}
-			}
+func (a *Adapter) write(message *router.Message, buf []byte) {
+	// keep messages in order while spooled ones are waiting to be replayed
+	if a.spool != nil && (a.conn == nil || !a.spool.Empty()) {
+		a.spoolWrite(message, buf)
+		return
+	}
+	_, err := a.conn.Write(buf)
+	if err == nil {
+		a.route.MarkWritten(message)
+		return
+	}
+	log.Println("syslog:", err)
+	if !a.connIsTCP {
+		a.route.CountWriteError()
+		return
+	}
+	if err = a.retry(buf, err); err != nil {
+		a.route.CountWriteError()
+		if a.spool == nil {
+			log.Panicf("syslog retry err: %+v", err)
 		}
+		log.Println("syslog: spooling to disk until reconnected:", err)
+		a.spoolWrite(message, buf)
+		return
+	}
+	a.route.MarkWritten(message)
+}
+
+func (a *Adapter) spoolWrite(message *router.Message, buf []byte) {
+	if err := a.spool.Append(buf); err != nil {
+		log.Println("syslog: spool:", err)
+		return
 	}
+	a.route.MarkDelivered(message)
+}
+
+func (a *Adapter) flushSpool() {
+	if a.conn != nil && a.spool.Empty() {
+		return
+	}
+	conn, err := a.spool.Replay(a.transport, a.route.Address, a.route.Options)
+	if err != nil {
+		log.Println("syslog: spool replay:", err)
+		return
+	}
+	if a.conn != nil {
+		a.conn.Close()
+	}
+	a.conn = conn
+	a.route.CountReconnect()
+	a.route.MarkWritten()
+	log.Println("syslog: reconnected, spool replayed")
 }
 
 func (a *Adapter) retry(buf []byte, err error) error {
@@ -276,6 +353,7 @@ func (a *Adapter) retry(buf []byte, err error) error {
 	if reconnErr := a.reconnect(); reconnErr != nil {
 		return reconnErr
 	}
+	a.route.CountReconnect()
 	if _, err = a.conn.Write(buf); err != nil {
 		log.Println("syslog: reconnect failed")
 		return err
@@ -286,7 +364,7 @@ func (a *Adapter) retry(buf []byte, err error) error {
 
 func (a *Adapter) retryTemporary(buf []byte) error {
 	log.Printf("syslog: retrying tcp up to %v times\n", a.retryCount)
-	err := retryExp(func() error {
+	err := a.retryExp(func() error {
 		_, err := a.conn.Write(buf)
 		if err == nil {
 			log.Println("syslog: retry successful")
@@ -306,7 +384,7 @@ func (a *Adapter) retryTemporary(buf []byte) error {
 
 func (a *Adapter) reconnect() error {
 	log.Printf("syslog: reconnecting up to %v times\n", a.retryCount)
-	err := retryExp(func() error {
+	err := a.retryExp(func() error {
 		conn, err := a.transport.Dial(a.route.Address, a.route.Options)
 		if err != nil {
 			return err
@@ -321,7 +399,9 @@ func (a *Adapter) reconnect() error {
 	return nil
 }
 
-func retryExp(fun func() error, tries uint) error {
+// retryExp calls fun until it succeeds, up to tries more times with an
+// exponential backoff, counting the retries of the route
+func (a *Adapter) retryExp(fun func() error, tries uint) error {
 	var try uint
 	for {
 		err := fun()
@@ -334,6 +414,8 @@ func retryExp(fun func() error, tries uint) error {
 			return err
 		}
 
+		a.route.CountRetry()
+
 		time.Sleep((1 << try) * 10 * time.Millisecond)
 	}
 }
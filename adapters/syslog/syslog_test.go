@@ -207,6 +207,51 @@ func TestSyslogReconnectOnClose(t *testing.T) {
 	}
 }
 
+func TestSyslogSpoolUntilDialed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("BUFFERPATH", dir)
+	defer os.Unsetenv("BUFFERPATH")
+	defer func(interval time.Duration) { router.SpoolFlushInterval = interval }(router.SpoolFlushInterval)
+	router.SpoolFlushInterval = 10 * time.Millisecond
+
+	// find a free port the destination listens on only once messages are spooled
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	route := &router.Route{Adapter: "syslog+tcp", Address: addr, Options: map[string]string{"buffer": "disk"}}
+	adapter, err := NewSyslogAdapter(route)
+	if err != nil {
+		t.Fatal("expected route creation to succeed while the destination is down:", err)
+	}
+	stream := make(chan *router.Message)
+	go adapter.Stream(stream)
+	defer close(stream)
+	stream <- &router.Message{Container: container, Data: "spooled", Time: time.Now()}
+
+	if l, err = net.Listen("tcp", addr); err != nil {
+		t.Skip("port taken:", err)
+	}
+	defer l.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.HasSuffix(line, " spooled\n") {
+		t.Errorf("expected spooled message to be replayed, got %q and %v", line, err)
+	}
+}
+
 func TestHostnameDoesNotHaveLineFeed(t *testing.T) {
 	if err := ioutil.WriteFile(hostHostnameFilename, []byte(badHostnameContent), 0777); err != nil {
 		t.Fatal(err)
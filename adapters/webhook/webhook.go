@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gliderlabs/logspout/cfg"
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	// NDJSONFormat sends one JSON record per line
+	NDJSONFormat = "ndjson"
+	// JSONFormat sends a JSON array of records
+	JSONFormat = "json"
+	// TemplateFormat sends the concatenated renderings of a template
+	TemplateFormat = "template"
+
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	requestTimeout       = 30 * time.Second
+
+	headerOption     = "http.header."
+	headerEnvOption  = "http.header_env."
+	headerFileOption = "http.header_file."
+)
+
+var hostname string
+
+var funcs = template.FuncMap{
+	"toJSON": func(value interface{}) string {
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			log.Println("error marshaling to JSON: ", err)
+			return "null"
+		}
+		return string(bytes)
+	},
+}
+
+func init() {
+	hostname, _ = os.Hostname()
+	router.AdapterFactories.Register(NewWebhookAdapter, "http")
+	router.AdapterFactories.Register(NewWebhookAdapter, "https")
+	router.SecretOptions(headerOption)
+}
+
+// NewWebhookAdapter returns a configured webhook.Adapter
+func NewWebhookAdapter(route *router.Route) (router.LogAdapter, error) {
+	a := &Adapter{
+		route:  route,
+		url:    route.AdapterType() + "://" + route.Address + route.Path,
+		client: &http.Client{Timeout: requestTimeout},
+		format: route.Options["http.format"],
+		gzip:   route.Options["http.gzip"] == "true",
+		header: make(http.Header),
+	}
+
+	tmplStr := route.Options["http.template"]
+	if tmplStr == "" {
+		tmplStr = os.Getenv("HTTP_TEMPLATE")
+	}
+	switch a.format {
+	case "":
+		a.format = NDJSONFormat
+		if tmplStr != "" {
+			a.format = TemplateFormat
+		}
+	case NDJSONFormat, JSONFormat:
+	case TemplateFormat:
+		if tmplStr == "" {
+			return nil, errors.New("http.template is required with http.format=template")
+		}
+	default:
+		return nil, errors.New("bad http.format: " + a.format)
+	}
+	switch a.format {
+	case NDJSONFormat:
+		a.header.Set("Content-Type", "application/x-ndjson")
+	case JSONFormat:
+		a.header.Set("Content-Type", "application/json")
+	case TemplateFormat:
+		var err error
+		if a.tmpl, err = template.New("http").Funcs(funcs).Parse(tmplStr); err != nil {
+			return nil, errors.New("bad http.template: " + err.Error())
+		}
+		a.header.Set("Content-Type", cfg.GetEnvDefault("HTTP_CONTENT_TYPE", "text/plain"))
+		if contentType := route.Options["http.content_type"]; contentType != "" {
+			a.header.Set("Content-Type", contentType)
+		}
+	}
+	if a.gzip {
+		a.header.Set("Content-Encoding", "gzip")
+	}
+	if err := a.setHeaders(route.Options); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if a.batchSize, a.batchInterval, err = route.BatchOptions(defaultBatchSize, defaultBatchInterval); err != nil {
+		return nil, err
+	}
+	if a.retries, err = route.RetryCount(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// setHeaders sets the request headers configured by http.header.<name>
+// options, or read from the environment variables and files named by
+// http.header_env.<name> and http.header_file.<name> options, so secrets like
+// auth tokens don't have to appear in routes
+func (a *Adapter) setHeaders(options map[string]string) error {
+	for key, value := range options {
+		switch {
+		case strings.HasPrefix(key, headerOption):
+			a.header.Set(strings.TrimPrefix(key, headerOption), value)
+		case strings.HasPrefix(key, headerEnvOption):
+			env, ok := os.LookupEnv(value)
+			if !ok {
+				return errors.New("bad " + key + ": " + value + " is not set")
+			}
+			a.header.Set(strings.TrimPrefix(key, headerEnvOption), env)
+		case strings.HasPrefix(key, headerFileOption):
+			content, err := ioutil.ReadFile(value)
+			if err != nil {
+				return errors.New("bad " + key + ": " + err.Error())
+			}
+			a.header.Set(strings.TrimPrefix(key, headerFileOption), strings.TrimSpace(string(content)))
+		}
+	}
+	return nil
+}
+
+// Adapter posts batches of log messages to an HTTP endpoint
+type Adapter struct {
+	route         *router.Route
+	url           string
+	client        *http.Client
+	format        string
+	tmpl          *template.Template
+	gzip          bool
+	header        http.Header
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+}
+
+// Stream posts batches of log messages
+func (a *Adapter) Stream(logstream chan *router.Message) {
+	router.Batch(logstream, a.batchSize, a.batchInterval, a.flush)
+}
+
+func (a *Adapter) flush(batch []*router.Message) {
+	body, err := a.render(batch)
+	if err != nil {
+		log.Println("http:", err)
+		return
+	}
+	if a.gzip {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		w.Write(body)
+		w.Close()
+		body = b.Bytes()
+	}
+	err = a.route.Retry(a.retries, func() error {
+		return a.post(body)
+	}, batch...)
+	if err != nil {
+		log.Printf("http: dropping %d messages: %v", len(batch), err)
+		a.route.CountWriteError()
+	}
+}
+
+// render encodes a batch of messages in the format of the adapter
+func (a *Adapter) render(batch []*router.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	switch a.format {
+	case JSONFormat:
+		records := make([]*router.Record, len(batch))
+		for i, message := range batch {
+			records[i] = router.NewRecord(message, hostname)
+		}
+		if err := json.NewEncoder(&buf).Encode(records); err != nil {
+			return nil, err
+		}
+	case NDJSONFormat:
+		enc := json.NewEncoder(&buf)
+		for _, message := range batch {
+			if err := enc.Encode(router.NewRecord(message, hostname)); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		for _, message := range batch {
+			if err := a.tmpl.Execute(&buf, message); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *Adapter) post(body []byte) error {
+	req, err := http.NewRequest("POST", a.url, bytes.NewReader(body))
+	if err != nil {
+		return router.Permanent(err)
+	}
+	for key, values := range a.header {
+		req.Header[key] = values
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return router.CheckHTTPResponse(resp)
+}
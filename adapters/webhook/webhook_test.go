@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/gliderlabs/logspout/router/routertest"
+)
+
+var container = &docker.Container{
+	ID:     "8dfafdbc3a40",
+	Name:   "/app",
+	Config: &docker.Config{Image: "nginx:1.21", Labels: map[string]string{"team": "web"}},
+}
+
+func init() {
+	router.RetryBackoff = time.Millisecond
+}
+
+func streamMessages(t *testing.T, srv *httptest.Server, options map[string]string, data ...string) {
+	route := &router.Route{
+		Adapter: "http",
+		Address: strings.TrimPrefix(srv.URL, "http://"),
+		Path:    "/logs",
+		Options: options,
+	}
+	adapter, err := NewWebhookAdapter(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]*router.Message, len(data))
+	for i, d := range data {
+		messages[i] = &router.Message{Container: container, Source: "stdout", Data: d, Time: time.Now()}
+	}
+	routertest.Stream(adapter, messages...)
+}
+
+func TestWebhookNDJSON(t *testing.T) {
+	requests := make(chan routertest.Request, 2)
+	srv := routertest.NewServer(requests, http.StatusServiceUnavailable)
+	defer srv.Close()
+	os.Setenv("TEST_WEBHOOK_TOKEN", "secret")
+	defer os.Unsetenv("TEST_WEBHOOK_TOKEN")
+	streamMessages(t, srv, map[string]string{
+		"batch.size":                    "2",
+		"http.header.X-Source":          "logspout",
+		"http.header_env.Authorization": "TEST_WEBHOOK_TOKEN",
+	}, "one", "two", "three")
+
+	req := <-requests
+	if req.Path != "/logs" {
+		t.Errorf("expected path /logs got %s", req.Path)
+	}
+	if req.Header.Get("Authorization") != "secret" || req.Header.Get("X-Source") != "logspout" ||
+		req.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	var records []router.Record
+	scanner := bufio.NewScanner(bytes.NewReader(req.Body))
+	for scanner.Scan() {
+		var record router.Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 || records[0].Message != "one" || records[1].Container.Name != "app" {
+		t.Errorf("unexpected records %+v", records)
+	}
+	if req := <-requests; !strings.Contains(string(req.Body), `"message":"three"`) {
+		t.Errorf("expected second batch with message three got %s", req.Body)
+	}
+}
+
+func TestWebhookJSONGzip(t *testing.T) {
+	requests := make(chan routertest.Request, 1)
+	srv := routertest.NewServer(requests)
+	defer srv.Close()
+	streamMessages(t, srv, map[string]string{"http.format": "json", "http.gzip": "true"}, "one", "two")
+
+	req := <-requests
+	if req.Header.Get("Content-Encoding") != "gzip" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(req.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []router.Record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].Message != "two" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	requests := make(chan routertest.Request, 1)
+	srv := routertest.NewServer(requests)
+	defer srv.Close()
+	tokenFile, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tokenFile.Name())
+	tokenFile.WriteString("Splunk 1234\n")
+	tokenFile.Close()
+	streamMessages(t, srv, map[string]string{
+		"http.template":                  `{"event":{{toJSON .Data}}}` + "\n",
+		"http.content_type":              "application/json",
+		"http.header_file.Authorization": tokenFile.Name(),
+	}, "one", "two")
+
+	req := <-requests
+	if string(req.Body) != "{\"event\":\"one\"}\n{\"event\":\"two\"}\n" {
+		t.Errorf("unexpected body %q", req.Body)
+	}
+	if req.Header.Get("Authorization") != "Splunk 1234" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+}
+
+func TestWebhookPermanentFailure(t *testing.T) {
+	requests := make(chan routertest.Request, 1)
+	srv := routertest.NewServer(requests, http.StatusBadRequest)
+	defer srv.Close()
+	streamMessages(t, srv, nil, "one")
+	select {
+	case <-requests:
+		t.Error("expected batch rejected with status 400 not to be retried")
+	default:
+	}
+}
+
+func TestWebhookBadOptions(t *testing.T) {
+	for _, opts := range []map[string]string{
+		{"http.format": "xml"},
+		{"http.format": "template"},
+		{"http.template": "{{"},
+		{"http.header_env.Authorization": "TEST_WEBHOOK_UNSET"},
+		{"http.header_file.Authorization": "/nonexistent"},
+		{"batch.interval": "-1s"},
+	} {
+		route := &router.Route{Adapter: "https", Address: "example.com/logs", Options: opts}
+		if _, err := NewWebhookAdapter(route); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package redact
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+const defaultReplacement = "[REDACTED]"
+
+func init() {
+	router.LogFilterFactories.Register(NewRedactFilter, "redact")
+}
+
+// NewRedactFilter returns a filter replacing the matches of the route's
+// redact.pattern option in messages with redact.replacement
+func NewRedactFilter(route *router.Route) (router.LogFilter, error) {
+	if route.Options["redact.pattern"] == "" {
+		return nil, errors.New("redact.pattern is required")
+	}
+	pattern, err := regexp.Compile(route.Options["redact.pattern"])
+	if err != nil {
+		return nil, errors.New("bad redact.pattern: " + err.Error())
+	}
+	replacement, ok := route.Options["redact.replacement"]
+	if !ok {
+		replacement = defaultReplacement
+	}
+	return &Filter{pattern: pattern, replacement: replacement}, nil
+}
+
+// Filter is a filter redacting the data and string fields of messages
+type Filter struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Filter returns a copy of message with its data and string fields redacted
+func (f *Filter) Filter(message *router.Message) *router.Message {
+	redacted := *message
+	redacted.Data = f.pattern.ReplaceAllLiteralString(message.Data, f.replacement)
+	if message.Fields != nil {
+		redacted.Fields = make(map[string]interface{}, len(message.Fields))
+		for key, value := range message.Fields {
+			if s, ok := value.(string); ok {
+				value = f.pattern.ReplaceAllLiteralString(s, f.replacement)
+			}
+			redacted.Fields[key] = value
+		}
+	}
+	return &redacted
+}
@@ -0,0 +1,49 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+func TestRedactFilter(t *testing.T) {
+	route := &router.Route{Options: map[string]string{"redact.pattern": `password=\S+`}}
+	filter, err := NewRedactFilter(route)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	original := &router.Message{
+		Data:   "login password=hunter2 ok",
+		Fields: map[string]interface{}{"msg": "password=hunter2", "count": float64(1)},
+	}
+	msg := filter.Filter(original)
+	if msg.Data != "login [REDACTED] ok" {
+		t.Errorf("expected data to be redacted, got %q", msg.Data)
+	}
+	if msg.Fields["msg"] != "[REDACTED]" || msg.Fields["count"] != float64(1) {
+		t.Errorf("expected string fields to be redacted, got %v", msg.Fields)
+	}
+	if original.Data != "login password=hunter2 ok" || original.Fields["msg"] != "password=hunter2" {
+		t.Error("expected original message to be unchanged")
+	}
+}
+
+func TestRedactFilterReplacement(t *testing.T) {
+	route := &router.Route{Options: map[string]string{"redact.pattern": `\d{4}`, "redact.replacement": "****"}}
+	filter, err := NewRedactFilter(route)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if msg := filter.Filter(&router.Message{Data: "card 1234"}); msg.Data != "card ****" {
+		t.Errorf("expected %q got %q", "card ****", msg.Data)
+	}
+}
+
+func TestRedactFilterBadPattern(t *testing.T) {
+	for _, pattern := range []string{"", "("} {
+		route := &router.Route{Options: map[string]string{"redact.pattern": pattern}}
+		if _, err := NewRedactFilter(route); err == nil {
+			t.Errorf("expected error for pattern %q", pattern)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package sample
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+func init() {
+	router.LogFilterFactories.Register(NewSampleFilter, "sample")
+}
+
+// NewSampleFilter returns a filter keeping one in every sample.rate messages
+func NewSampleFilter(route *router.Route) (router.LogFilter, error) {
+	rate, err := strconv.ParseUint(route.Options["sample.rate"], 10, 64)
+	if err != nil || rate == 0 {
+		return nil, errors.New("bad sample.rate: " + route.Options["sample.rate"])
+	}
+	return &Filter{rate: rate}, nil
+}
+
+// Filter is a filter dropping all but one in every rate messages
+type Filter struct {
+	count uint64
+	rate  uint64
+}
+
+// Filter returns message if it is sampled, nil otherwise
+func (f *Filter) Filter(message *router.Message) *router.Message {
+	if (atomic.AddUint64(&f.count, 1)-1)%f.rate != 0 {
+		return nil
+	}
+	return message
+}
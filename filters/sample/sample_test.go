@@ -0,0 +1,31 @@
+package sample
+
+import (
+	"testing"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+func TestSampleFilter(t *testing.T) {
+	filter, err := NewSampleFilter(&router.Route{Options: map[string]string{"sample.rate": "3"}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	kept := 0
+	for i := 0; i < 9; i++ {
+		if filter.Filter(&router.Message{Data: "test"}) != nil {
+			kept++
+		}
+	}
+	if kept != 3 {
+		t.Errorf("expected 3 messages to be kept, got %d", kept)
+	}
+}
+
+func TestSampleFilterBadRate(t *testing.T) {
+	for _, rate := range []string{"", "0", "-1", "half"} {
+		if _, err := NewSampleFilter(&router.Route{Options: map[string]string{"sample.rate": rate}}); err == nil {
+			t.Errorf("expected error for rate %q", rate)
+		}
+	}
+}
@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/Microsoft/hcsshim v0.8.14 // indirect
+	github.com/Shopify/sarama v1.29.0
 	github.com/Sirupsen/logrus v0.10.1-0.20160601113210-f3cfb454f4c2 // indirect
 	github.com/containerd/cgroups v0.0.0-20210114181951-8a68de567b68 // indirect
 	github.com/containerd/containerd v1.4.3 // indirect
@@ -12,15 +13,19 @@ require (
 	github.com/docker/engine-api v0.3.2-0.20160708123604-98348ad6f9c8 // indirect
 	github.com/fsouza/go-dockerclient v1.7.0
 	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/golang/snappy v0.0.4
 	github.com/gorilla/context v0.0.0-20160525203319-aed02d124ae4 // indirect
 	github.com/gorilla/mux v1.8.0
 	github.com/hashicorp/go-cleanhttp v0.0.0-20160407174126-ad28ea4487f0 // indirect
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 	github.com/looplab/logspout-logstash v0.0.0-20171130125839-68a4e47e757d
 	github.com/moby/term v0.0.0-20201216013528-df9cb8a40635 // indirect
+	github.com/nats-io/nats.go v1.10.0
 	github.com/opencontainers/runc v1.0.0-rc1.0.20160706165155-9d7831e41d3e // indirect
+	github.com/rabbitmq/amqp091-go v1.2.0
+	github.com/xdg-go/scram v1.0.2
 	go.opencensus.io v0.22.6 // indirect
-	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b
+	golang.org/x/net v0.0.0-20210427231257-85d9c07bbe3a
 	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a // indirect
-	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c // indirect
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
 )
@@ -1,6 +1,7 @@
 package healthcheck
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -8,15 +9,105 @@ import (
 	"github.com/gliderlabs/logspout/router"
 )
 
+// Statuses of health reports
+const (
+	StatusOK   = "ok"
+	StatusDown = "down"
+)
+
 func init() {
 	router.HTTPHandlers.Register(HealthCheck, "health")
 }
 
-// HealthCheck returns a http.Handler for the health check
+// pump is implemented by log routers reading logs from Docker, like the
+// default pump
+type pump interface {
+	Health() router.PumpHealth
+	Ping() error
+}
+
+// Report is the JSON body of the liveness and readiness checks
+type Report struct {
+	Status string               `json:"status"`
+	Docker *Docker              `json:"docker,omitempty"`
+	Routes []router.RouteHealth `json:"routes,omitempty"`
+}
+
+// Docker is the state of the connection to the Docker API. Whether it is
+// reachable is only checked for readiness.
+type Docker struct {
+	Reachable *bool  `json:"reachable,omitempty"`
+	Error     string `json:"error,omitempty"`
+	router.PumpHealth
+}
+
+// HealthCheck returns a http.Handler for the health checks
 func HealthCheck() http.Handler {
 	r := mux.NewRouter()
 	r.HandleFunc("/health", func(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte("Healthy!\n"))
 	})
+	r.HandleFunc("/health/live", func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, live(lookupPump()))
+	})
+	r.HandleFunc("/health/ready", func(w http.ResponseWriter, req *http.Request) {
+		routes, _ := router.Routes.GetAll()
+		writeReport(w, ready(lookupPump(), routes))
+	})
 	return r
 }
+
+func lookupPump() pump {
+	if p, ok := router.LogRouters.Lookup("pump"); ok {
+		if p, ok := p.(pump); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// live reports logspout down once the Docker event listener is closed
+func live(p pump) *Report {
+	report := &Report{Status: StatusOK}
+	if p != nil {
+		report.Docker = &Docker{PumpHealth: p.Health()}
+		if report.Docker.Events == router.EventsClosed {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// ready reports logspout down unless the Docker API is reachable, the
+// Docker event listener is listening and no critical route is failed
+func ready(p pump, routes []*router.Route) *Report {
+	report := live(p)
+	if p != nil {
+		reachable := true
+		if err := p.Ping(); err != nil {
+			reachable = false
+			report.Docker.Error = err.Error()
+			report.Status = StatusDown
+		}
+		report.Docker.Reachable = &reachable
+		if report.Docker.Events != router.EventsListening {
+			report.Status = StatusDown
+		}
+	}
+	for _, route := range routes {
+		health := route.Health()
+		if health.Critical && health.State == router.RouteFailed {
+			report.Status = StatusDown
+		}
+		report.Routes = append(report.Routes, health)
+	}
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
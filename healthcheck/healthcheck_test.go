@@ -0,0 +1,89 @@
+package healthcheck
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+type fakePump struct {
+	events  string
+	pingErr error
+}
+
+func (p *fakePump) Health() router.PumpHealth {
+	return router.PumpHealth{Events: p.events}
+}
+
+func (p *fakePump) Ping() error {
+	return p.pingErr
+}
+
+func TestLive(t *testing.T) {
+	for events, expected := range map[string]string{
+		router.EventsStarting:  StatusOK,
+		router.EventsListening: StatusOK,
+		router.EventsClosed:    StatusDown,
+	} {
+		if report := live(&fakePump{events: events}); report.Status != expected {
+			t.Errorf("expected %s with events %s, got %s", expected, events, report.Status)
+		}
+	}
+}
+
+func TestReady(t *testing.T) {
+	failed := &router.Route{ID: "a1", Adapter: "syslog+tcp"}
+	failed.CountWriteError()
+	optional := &router.Route{ID: "b2", Adapter: "loki", Options: map[string]string{"health.critical": "false"}}
+	optional.CountWriteError()
+	written := &router.Route{ID: "c3", Adapter: "raw"}
+	written.MarkWritten()
+
+	listening := &fakePump{events: router.EventsListening}
+	for _, tc := range []struct {
+		pump     pump
+		routes   []*router.Route
+		expected string
+	}{
+		{listening, []*router.Route{optional, written}, StatusOK},
+		{listening, []*router.Route{failed, written}, StatusDown},
+		{&fakePump{events: router.EventsStarting}, nil, StatusDown},
+		{&fakePump{events: router.EventsListening, pingErr: errors.New("connection refused")}, nil, StatusDown},
+		{nil, []*router.Route{written}, StatusOK},
+	} {
+		if report := ready(tc.pump, tc.routes); report.Status != tc.expected {
+			t.Errorf("expected %s, got %+v", tc.expected, report)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	route := &router.Route{ID: "a1", Adapter: "syslog+tcp"}
+	route.CountWriteError()
+	rec := httptest.NewRecorder()
+	writeReport(rec, ready(&fakePump{events: router.EventsListening}, []*router.Route{route}))
+	if rec.Code != 503 || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response %d with content type %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var report struct {
+		Status string
+		Docker struct {
+			Reachable bool
+			Events    string
+		}
+		Routes []struct {
+			ID    string
+			State string
+		}
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != StatusDown || !report.Docker.Reachable || report.Docker.Events != router.EventsListening ||
+		len(report.Routes) != 1 || report.Routes[0].State != router.RouteFailed {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
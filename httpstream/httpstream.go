@@ -14,7 +14,12 @@ import (
 	"github.com/gliderlabs/logspout/router"
 )
 
-const maxRouteIDLen = 12
+const (
+	maxRouteIDLen = 12
+	// streamBuffer is how many messages wait for a slow client before the
+	// oldest are dropped
+	streamBuffer = 1024
+)
 
 func init() {
 	router.HTTPHandlers.Register(LogStreamer, "logs")
@@ -51,7 +56,7 @@ func LogStreamer() http.Handler {
 		}
 
 		defer debug("http: logs streamer disconnected")
-		logstream := make(chan *router.Message)
+		logstream := make(chan *router.Message, streamBuffer)
 		defer close(logstream)
 
 		var closer <-chan struct{}
@@ -52,10 +52,10 @@ func main() {
 		for _, route := range routes {
 			fmt.Fprintf(w, "#   %s\t%s\t%s\t%s\t%s\n",
 				route.Adapter,
-				route.Address,
+				route.Address+route.Path,
 				route.FilterID+route.FilterName+strings.Join(route.FilterLabels, ","),
 				strings.Join(route.FilterSources, ","),
-				route.Options)
+				route.RedactedOptions())
 		}
 		w.Flush()
 	} else {
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+const (
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// ReservedPrefix is the prefix of the names of the metrics of logspout
+	ReservedPrefix = "logspout_"
+)
+
+func init() {
+	router.HTTPHandlers.Register(Metrics, "metrics")
+}
+
+// containerSource is implemented by log routers reporting the containers
+// they pump logs from, like the default pump
+type containerSource interface {
+	Containers() []router.ContainerCounters
+}
+
+// Collector is implemented by modules exporting metrics of their own, like
+// the metrics adapter
+type Collector interface {
+	// Collect writes metrics in the Prometheus text format
+	Collect(w *bufio.Writer)
+}
+
+var (
+	collectorsMu sync.Mutex
+	collectors   []Collector
+	families     = make(map[string]Collector) // metric names of the collectors
+)
+
+// Register adds a collector whose metrics are exported with those of
+// logspout, under the metric names it writes. It fails when one of them is
+// reserved or exported by another collector already, as duplicate metrics
+// break scrapes.
+func Register(c Collector, names ...string) error {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	for _, name := range names {
+		if strings.HasPrefix(name, ReservedPrefix) {
+			return errors.New("metric " + name + " is reserved")
+		}
+		if families[name] != nil {
+			return errors.New("metric " + name + " is exported already")
+		}
+	}
+	for _, name := range names {
+		families[name] = c
+	}
+	collectors = append(collectors, c)
+	return nil
+}
+
+// Unregister removes a collector and frees its metric names
+func Unregister(c Collector) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	for name, registered := range families {
+		if registered == c {
+			delete(families, name)
+		}
+	}
+	for i, registered := range collectors {
+		if registered == c {
+			collectors = append(collectors[:i], collectors[i+1:]...)
+			return
+		}
+	}
+}
+
+// Metrics returns a http.Handler exporting the metrics of logspout in the
+// Prometheus text format
+func Metrics() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		routes, _ := router.Routes.GetAll()
+		var containers []router.ContainerCounters
+		if pump, ok := router.LogRouters.Lookup("pump"); ok {
+			if source, ok := pump.(containerSource); ok {
+				containers = source.Containers()
+			}
+		}
+		bw := bufio.NewWriter(w)
+		write(bw, routes, containers)
+		collectorsMu.Lock()
+		for _, c := range collectors {
+			c.Collect(bw)
+		}
+		collectorsMu.Unlock()
+		bw.Flush()
+	}).Methods("GET")
+	return r
+}
+
+// family is a metric with its samples
+type family struct {
+	name    string
+	typ     string
+	help    string
+	samples []sample
+}
+
+type sample struct {
+	labels []string // label names and values
+	value  uint64
+}
+
+func (f *family) add(value uint64, labels ...string) {
+	f.samples = append(f.samples, sample{labels, value})
+}
+
+// write writes the metrics of routes and containers
+func write(w *bufio.Writer, routes []*router.Route, containers []router.ContainerCounters) {
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+	routeFamily := func(name, typ, help string, value func(c router.RouteCounters, q router.QueueStats) uint64) *family {
+		f := &family{name: "logspout_route_" + name, typ: typ, help: help}
+		for _, route := range routes {
+			f.add(value(route.Counters(), route.QueueStats()), "route", route.ID, "adapter", route.Adapter)
+		}
+		return f
+	}
+	families := []*family{
+		routeFamily("messages_total", "counter", "Messages queued for the route.",
+			func(c router.RouteCounters, _ router.QueueStats) uint64 { return c.Messages }),
+		routeFamily("bytes_total", "counter", "Bytes of the messages queued for the route.",
+			func(c router.RouteCounters, _ router.QueueStats) uint64 { return c.Bytes }),
+		routeFamily("dropped_total", "counter", "Messages dropped because the queue of the route was full.",
+			func(c router.RouteCounters, _ router.QueueStats) uint64 { return c.Dropped }),
+		routeFamily("write_errors_total", "counter", "Writes of the route's adapter that failed.",
+			func(c router.RouteCounters, _ router.QueueStats) uint64 { return c.WriteErrors }),
+		routeFamily("reconnects_total", "counter", "Connections of the route's adapter made again after being lost.",
+			func(c router.RouteCounters, _ router.QueueStats) uint64 { return c.Reconnects }),
+		routeFamily("retries_total", "counter", "Writes of the route's adapter retried after a failure.",
+			func(c router.RouteCounters, _ router.QueueStats) uint64 { return c.Retries }),
+		routeFamily("queue_length", "gauge", "Messages waiting in the queue of the route.",
+			func(_ router.RouteCounters, q router.QueueStats) uint64 { return uint64(q.Length) }),
+		routeFamily("queue_size", "gauge", "Capacity of the queue of the route.",
+			func(_ router.RouteCounters, q router.QueueStats) uint64 { return uint64(q.Size) }),
+	}
+
+	pumps := &family{name: "logspout_pumps", typ: "gauge", help: "Containers logs are being pumped from."}
+	pumps.add(uint64(len(containers)))
+	messages := &family{name: "logspout_container_messages_total", typ: "counter", help: "Log lines read from the container."}
+	bytes := &family{name: "logspout_container_bytes_total", typ: "counter", help: "Bytes of the log lines read from the container."}
+	for _, c := range containers {
+		messages.add(c.Messages, "container_id", c.ID, "container_name", c.Name)
+		bytes.add(c.Bytes, "container_id", c.ID, "container_name", c.Name)
+	}
+	families = append(families, pumps, messages, bytes)
+
+	for _, f := range families {
+		w.WriteString("# HELP " + f.name + " " + f.help + "\n")
+		w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			w.WriteString(f.name)
+			if len(s.labels) > 0 {
+				w.WriteByte('{')
+				for i := 0; i < len(s.labels); i += 2 {
+					if i > 0 {
+						w.WriteByte(',')
+					}
+					w.WriteString(s.labels[i] + `="` + EscapeLabel(s.labels[i+1]) + `"`)
+				}
+				w.WriteByte('}')
+			}
+			w.WriteString(" " + strconv.FormatUint(s.value, 10) + "\n")
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// EscapeLabel escapes a label value for the Prometheus text format
+func EscapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+func TestWrite(t *testing.T) {
+	syslog := &router.Route{ID: "b2", Adapter: "syslog+tcp"}
+	syslog.CountWriteError()
+	syslog.CountReconnect()
+	syslog.CountRetry()
+	syslog.CountRetry()
+	routes := []*router.Route{syslog, {ID: "a1", Adapter: "loki"}}
+	containers := []router.ContainerCounters{{ID: "8dfafdbc3a40", Name: `we"b`, Messages: 3, Bytes: 42}}
+
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+	write(w, routes, containers)
+	w.Flush()
+	out := b.String()
+
+	for _, expected := range []string{
+		"# TYPE logspout_route_messages_total counter\n" +
+			`logspout_route_messages_total{route="a1",adapter="loki"} 0` + "\n" +
+			`logspout_route_messages_total{route="b2",adapter="syslog+tcp"} 0` + "\n",
+		`logspout_route_write_errors_total{route="b2",adapter="syslog+tcp"} 1` + "\n",
+		`logspout_route_reconnects_total{route="b2",adapter="syslog+tcp"} 1` + "\n",
+		`logspout_route_retries_total{route="b2",adapter="syslog+tcp"} 2` + "\n",
+		"# TYPE logspout_route_queue_length gauge\n",
+		"# TYPE logspout_pumps gauge\nlogspout_pumps 1\n",
+		`logspout_container_messages_total{container_id="8dfafdbc3a40",container_name="we\"b"} 3` + "\n",
+		`logspout_container_bytes_total{container_id="8dfafdbc3a40",container_name="we\"b"} 42` + "\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Metrics().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != contentType {
+		t.Errorf("unexpected response %d with content type %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "# TYPE logspout_pumps gauge\nlogspout_pumps 0\n") {
+		t.Errorf("unexpected metrics:\n%s", rec.Body.String())
+	}
+}
+
+type fakeCollector string
+
+func (c fakeCollector) Collect(w *bufio.Writer) {
+	w.WriteString(string(c))
+}
+
+func TestRegister(t *testing.T) {
+	c := fakeCollector("# TYPE fake_total counter\nfake_total 1\n")
+	if err := Register(c, "fake_total"); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	Metrics().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasSuffix(rec.Body.String(), string(c)) {
+		t.Errorf("expected collected metrics in:\n%s", rec.Body.String())
+	}
+	Unregister(c)
+	rec = httptest.NewRecorder()
+	Metrics().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "fake_total") {
+		t.Errorf("expected no collected metrics in:\n%s", rec.Body.String())
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	c := fakeCollector("# TYPE fake_total counter\nfake_total 1\n")
+	if err := Register(c, "fake_total"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(fakeCollector(""), "other_total", "fake_total"); err == nil {
+		t.Error("expected an error registering a metric exported already")
+	}
+	if err := Register(fakeCollector(""), "logspout_pumps"); err == nil {
+		t.Error("expected an error registering a reserved metric")
+	}
+	Unregister(c)
+	other := fakeCollector("")
+	if err := Register(other, "other_total", "fake_total"); err != nil {
+		t.Errorf("expected the metric to be free once unregistered: %v", err)
+	}
+	Unregister(other)
+}
@@ -1,11 +1,28 @@
 package main
 
 import (
+	_ "github.com/gliderlabs/logspout/adapters/amqp"
+	_ "github.com/gliderlabs/logspout/adapters/elasticsearch"
+	_ "github.com/gliderlabs/logspout/adapters/file"
+	_ "github.com/gliderlabs/logspout/adapters/fluentd"
+	_ "github.com/gliderlabs/logspout/adapters/gelf"
+	_ "github.com/gliderlabs/logspout/adapters/kafka"
+	_ "github.com/gliderlabs/logspout/adapters/loki"
+	_ "github.com/gliderlabs/logspout/adapters/metrics"
 	_ "github.com/gliderlabs/logspout/adapters/multiline"
+	_ "github.com/gliderlabs/logspout/adapters/nats"
+	_ "github.com/gliderlabs/logspout/adapters/otlp"
 	_ "github.com/gliderlabs/logspout/adapters/raw"
+	_ "github.com/gliderlabs/logspout/adapters/redis"
+	_ "github.com/gliderlabs/logspout/adapters/s3"
+	_ "github.com/gliderlabs/logspout/adapters/splunk"
 	_ "github.com/gliderlabs/logspout/adapters/syslog"
+	_ "github.com/gliderlabs/logspout/adapters/webhook"
+	_ "github.com/gliderlabs/logspout/filters/redact"
+	_ "github.com/gliderlabs/logspout/filters/sample"
 	_ "github.com/gliderlabs/logspout/healthcheck"
 	_ "github.com/gliderlabs/logspout/httpstream"
+	_ "github.com/gliderlabs/logspout/metrics"
 	_ "github.com/gliderlabs/logspout/routesapi"
 	_ "github.com/gliderlabs/logspout/transports/tcp"
 	_ "github.com/gliderlabs/logspout/transports/tls"
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"errors"
+	"time"
+)
+
+// BatchOptions returns the batch.size and batch.interval options of a route,
+// or the given defaults when they aren't set
+func (r *Route) BatchOptions(size int, interval time.Duration) (int, time.Duration, error) {
+	size, err := r.IntOption("batch.size", size)
+	if err != nil {
+		return 0, 0, err
+	}
+	if size == 0 {
+		return 0, 0, errors.New("bad batch.size: 0")
+	}
+	interval, err = r.DurationOption("batch.interval", interval)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, interval, nil
+}
+
+// Batch reads the messages of logstream into batches of at most size messages.
+// It calls flush with each batch once it is full or interval after its first
+// message, and with what is left when logstream is closed. flush must not keep
+// the batch it is given.
+func Batch(logstream chan *Message, size int, interval time.Duration, flush func([]*Message)) {
+	batch := make([]*Message, 0, size)
+	timer := time.NewTimer(interval)
+	stopTimer(timer)
+	defer timer.Stop()
+	send := func() {
+		stopTimer(timer)
+		if len(batch) > 0 {
+			flush(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case message, ok := <-logstream:
+			if !ok {
+				send()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(interval)
+			}
+			batch = append(batch, message)
+			if len(batch) >= size {
+				send()
+			}
+		case <-timer.C:
+			send()
+		}
+	}
+}
+
+// stopTimer stops a timer and drains its channel if it had fired
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchSize(t *testing.T) {
+	logstream := make(chan *Message)
+	var batches [][]string
+	done := make(chan struct{})
+	go func() {
+		Batch(logstream, 2, time.Hour, func(batch []*Message) {
+			var data []string
+			for _, msg := range batch {
+				data = append(data, msg.Data)
+			}
+			batches = append(batches, data)
+		})
+		close(done)
+	}()
+	for _, data := range []string{"a", "b", "c", "d", "e"} {
+		logstream <- &Message{Data: data}
+	}
+	close(logstream)
+	<-done
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 || batches[2][0] != "e" {
+		t.Errorf("expected [[a b] [c d] [e]] got %v", batches)
+	}
+}
+
+func TestBatchInterval(t *testing.T) {
+	logstream := make(chan *Message)
+	flushed := make(chan int)
+	go Batch(logstream, 100, 10*time.Millisecond, func(batch []*Message) {
+		flushed <- len(batch)
+	})
+	defer close(logstream)
+	logstream <- &Message{Data: "a"}
+	logstream <- &Message{Data: "b"}
+	select {
+	case n := <-flushed:
+		if n != 2 {
+			t.Errorf("expected batch of 2 messages got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected batch to be flushed after the interval")
+	}
+}
+
+func TestBatchOptions(t *testing.T) {
+	route := &Route{Options: map[string]string{"batch.size": "50", "batch.interval": "2s"}}
+	size, interval, err := route.BatchOptions(100, time.Second)
+	if err != nil || size != 50 || interval != 2*time.Second {
+		t.Errorf("expected 50 2s got %v %v %v", size, interval, err)
+	}
+	size, interval, err = (&Route{}).BatchOptions(100, time.Second)
+	if err != nil || size != 100 || interval != time.Second {
+		t.Errorf("expected defaults got %v %v %v", size, interval, err)
+	}
+	for _, opts := range []map[string]string{
+		{"batch.size": "0"},
+		{"batch.size": "-1"},
+		{"batch.interval": "soon"},
+	} {
+		if _, _, err := (&Route{Options: opts}).BatchOptions(100, time.Second); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
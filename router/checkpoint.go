@@ -0,0 +1,125 @@
+package router
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckpointFileStore represents a directory storing, for each container,
+// the time of the last log message delivered by the routes
+type CheckpointFileStore string
+
+// Filename returns the filename in a CheckpointFileStore for a given container id
+func (fs CheckpointFileStore) Filename(id string) string {
+	return string(fs) + "/" + id
+}
+
+// Get returns the checkpoint of a container
+func (fs CheckpointFileStore) Get(id string) (time.Time, error) {
+	content, err := ioutil.ReadFile(fs.Filename(id))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(string(content)))
+}
+
+// GetAll returns the ids of all containers with a checkpoint
+func (fs CheckpointFileStore) GetAll() ([]string, error) {
+	files, err := ioutil.ReadDir(string(fs))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, file := range files {
+		if !file.IsDir() && !strings.HasPrefix(file.Name(), ".") {
+			ids = append(ids, file.Name())
+		}
+	}
+	return ids, nil
+}
+
+// Set writes the checkpoint of a container
+func (fs CheckpointFileStore) Set(id string, t time.Time) error {
+	// write to a temporary file first so a crash never leaves a torn checkpoint
+	tmp := string(fs) + "/." + id
+	if err := ioutil.WriteFile(tmp, []byte(t.Format(time.RFC3339Nano)+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.Filename(id))
+}
+
+// Remove removes the checkpoint of a container
+func (fs CheckpointFileStore) Remove(id string) bool {
+	return os.Remove(fs.Filename(id)) == nil
+}
+
+// routeDelivery tracks, for each container, the times of the last message
+// queued for a route and of the last one its adapter delivered
+type routeDelivery struct {
+	sync.Mutex
+	containers map[string]*delivery
+}
+
+type delivery struct {
+	queued    int64
+	delivered int64
+}
+
+// markQueued records a message queued for the route. Routes without an
+// adapter, like those of the logs HTTP streamer, don't hold back checkpoints.
+func (r *Route) markQueued(msg *Message) {
+	if r.adapter == nil || msg.Container == nil || msg.Time.IsZero() {
+		return
+	}
+	r.delivery.Lock()
+	defer r.delivery.Unlock()
+	if r.delivery.containers == nil {
+		r.delivery.containers = make(map[string]*delivery)
+	}
+	d := r.delivery.containers[msg.Container.ID]
+	if d == nil {
+		d = &delivery{}
+		r.delivery.containers[msg.Container.ID] = d
+	}
+	if t := msg.Time.UnixNano(); t > d.queued {
+		d.queued = t
+	}
+}
+
+// MarkDelivered records messages the route's adapter delivered, or stored
+// durably like in a disk spool, so that the checkpoints of their containers
+// can move past them
+func (r *Route) MarkDelivered(messages ...*Message) {
+	r.delivery.Lock()
+	defer r.delivery.Unlock()
+	for _, msg := range messages {
+		if msg.Container == nil || msg.Time.IsZero() {
+			continue
+		}
+		if d := r.delivery.containers[msg.Container.ID]; d != nil && msg.Time.UnixNano() > d.delivered {
+			d.delivered = msg.Time.UnixNano()
+		}
+	}
+}
+
+// undelivered returns the time of the last message of a container delivered
+// by the route, and whether messages queued after it wait to be delivered
+func (r *Route) undelivered(id string) (int64, bool) {
+	r.delivery.Lock()
+	defer r.delivery.Unlock()
+	d := r.delivery.containers[id]
+	if d == nil {
+		return 0, false
+	}
+	return d.delivered, d.delivered < d.queued
+}
+
+// forgetDelivery stops tracking the messages of a container
+func (r *Route) forgetDelivery(id string) {
+	r.delivery.Lock()
+	defer r.delivery.Unlock()
+	delete(r.delivery.containers, id)
+}
@@ -0,0 +1,134 @@
+package router
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func newTestCheckpointStore(t *testing.T) CheckpointFileStore {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CheckpointFileStore(dir)
+}
+
+func TestCheckpointFileStore(t *testing.T) {
+	fs := newTestCheckpointStore(t)
+	defer os.RemoveAll(string(fs))
+
+	if _, err := fs.Get("8dfafdbc3a40"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got: %v", err)
+	}
+	now := time.Now()
+	if err := fs.Set("8dfafdbc3a40", now); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := fs.Get("8dfafdbc3a40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkpoint.Equal(now) {
+		t.Errorf("expected %v got %v", now, checkpoint)
+	}
+	if ids, _ := fs.GetAll(); len(ids) != 1 || ids[0] != "8dfafdbc3a40" {
+		t.Errorf("expected [8dfafdbc3a40] got %v", ids)
+	}
+	if !fs.Remove("8dfafdbc3a40") {
+		t.Error("expected checkpoint to be removed")
+	}
+	if ids, _ := fs.GetAll(); len(ids) != 0 {
+		t.Errorf("expected no checkpoints got %v", ids)
+	}
+}
+
+func TestPumpSaveCheckpoint(t *testing.T) {
+	fs := newTestCheckpointStore(t)
+	defer os.RemoveAll(string(fs))
+	p := &LogsPump{
+		pumps:       make(map[string]*containerPump),
+		routes:      make(map[chan *update]struct{}),
+		checkpoints: fs,
+	}
+	container := &docker.Container{
+		ID:     "8dfafdbc3a40",
+		Config: &docker.Config{},
+	}
+	pump := newContainerPump(container, os.Stdout, os.Stderr)
+
+	p.saveCheckpoint("8dfafdbc3a40", pump)
+	if _, ok := p.checkpoint("8dfafdbc3a40"); ok {
+		t.Error("expected no checkpoint before any message was sent")
+	}
+
+	msgTime := time.Now().Add(-time.Minute)
+	pump.send(&Message{Data: "test data", Time: msgTime})
+	p.saveCheckpoint("8dfafdbc3a40", pump)
+	checkpoint, ok := p.checkpoint("8dfafdbc3a40")
+	if !ok {
+		t.Fatal("expected checkpoint after a message was sent")
+	}
+	if !checkpoint.Equal(msgTime) {
+		t.Errorf("expected checkpoint %v got %v", msgTime, checkpoint)
+	}
+
+	p.removeCheckpoint("8dfafdbc3a40")
+	if _, ok := p.checkpoint("8dfafdbc3a40"); ok {
+		t.Error("expected checkpoint to be removed")
+	}
+}
+
+func TestPumpSaveCheckpointDelivered(t *testing.T) {
+	fs := newTestCheckpointStore(t)
+	defer os.RemoveAll(string(fs))
+	p := &LogsPump{
+		pumps:       make(map[string]*containerPump),
+		routes:      make(map[chan *update]struct{}),
+		checkpoints: fs,
+	}
+	container := &docker.Container{
+		ID:     "8dfafdbc3a40",
+		Config: &docker.Config{},
+	}
+	pump := newContainerPump(container, os.Stdout, os.Stderr)
+	fast, slow := &Route{adapter: &DummyAdapter{}}, &Route{adapter: &DummyAdapter{}}
+	for _, route := range []*Route{fast, slow} {
+		if err := route.setupQueue(); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		pump.add(route.logstream, route)
+	}
+
+	first := time.Now().Add(-time.Minute)
+	second := first.Add(time.Second)
+	messages := []*Message{
+		{Container: container, Data: "first", Time: first},
+		{Container: container, Data: "second", Time: second},
+	}
+	for _, msg := range messages {
+		pump.send(msg)
+	}
+	// a line of the other stream pumped late
+	pump.send(&Message{Container: container, Data: "late", Time: first.Add(-time.Second)})
+	p.saveCheckpoint(container.ID, pump)
+	if _, ok := p.checkpoint(container.ID); ok {
+		t.Error("expected no checkpoint before messages were delivered")
+	}
+
+	fast.MarkWritten(messages...)
+	slow.MarkWritten(messages[0])
+	p.saveCheckpoint(container.ID, pump)
+	if checkpoint, _ := p.checkpoint(container.ID); !checkpoint.Equal(first) {
+		t.Errorf("expected checkpoint %v of the slowest route got %v", first, checkpoint)
+	}
+
+	slow.MarkWritten(messages[1])
+	p.saveCheckpoint(container.ID, pump)
+	if checkpoint, _ := p.checkpoint(container.ID); !checkpoint.Equal(second) {
+		t.Errorf("expected checkpoint %v got %v", second, checkpoint)
+	}
+}
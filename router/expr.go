@@ -0,0 +1,360 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// Filter expressions combine comparisons of container and message attributes
+// with &&, || and !, e.g.:
+//
+//	name!~"*-sidecar" && (label.team=="a" || label.team=="b")
+//
+// == and != compare strings, =~ and !~ match glob patterns. The attributes
+// are id, name, label.<key>, image, project, service, network, source and
+// data. Source and data are unknown when matching containers, so expressions
+// are evaluated with three-valued logic: a container is routed unless the
+// expression is false whatever its messages, and each message is then matched
+// against the whole expression. Attributes with several values, like the
+// networks of a container, match if any value does, and != and !~ hold if
+// no value does.
+
+// exprValue is the result of evaluating a filter expression
+type exprValue int
+
+const (
+	exprFalse exprValue = iota
+	exprUnknown
+	exprTrue
+)
+
+func exprBool(b bool) exprValue {
+	if b {
+		return exprTrue
+	}
+	return exprFalse
+}
+
+// exprEnv holds the attributes a filter expression is evaluated against
+type exprEnv struct {
+	container bool
+	id        string
+	name      string
+	labels    map[string]string
+	details   *docker.Container // nil when only id, name and labels are known
+	message   *Message
+}
+
+// lookup returns the values of an attribute, and whether they are known
+func (env *exprEnv) lookup(attr string) ([]string, bool) {
+	switch {
+	case attr == "source":
+		if env.message == nil {
+			return nil, false
+		}
+		return []string{env.message.Source}, true
+	case attr == "data":
+		if env.message == nil {
+			return nil, false
+		}
+		return []string{env.message.Data}, true
+	case !env.container:
+		return nil, false
+	case attr == "id":
+		return []string{env.id}, true
+	case attr == "name":
+		return []string{env.name}, true
+	case attr == "project":
+		return []string{env.labels[composeProjectLabel]}, true
+	case attr == "service":
+		return []string{env.labels[swarmServiceLabel]}, true
+	case attr == "image":
+		if env.details == nil {
+			return nil, false
+		}
+		return containerImages(env.details), true
+	case attr == "network":
+		if env.details == nil {
+			return nil, false
+		}
+		return containerNetworks(env.details), true
+	default:
+		return []string{env.labels[strings.TrimPrefix(attr, "label.")]}, true
+	}
+}
+
+// containerExprEnv returns the attributes of a container
+func containerExprEnv(container *docker.Container) *exprEnv {
+	env := &exprEnv{
+		container: true,
+		id:        normalID(container.ID),
+		name:      normalName(container.Name),
+		details:   container,
+	}
+	if container.Config != nil {
+		env.labels = container.Config.Labels
+	}
+	return env
+}
+
+// messageExprEnv returns the attributes of a message and of its container, if any
+func messageExprEnv(message *Message) *exprEnv {
+	env := &exprEnv{}
+	if message.Container != nil {
+		env = containerExprEnv(message.Container)
+	}
+	env.message = message
+	return env
+}
+
+type exprNode interface {
+	eval(env *exprEnv) exprValue
+}
+
+type exprAnd [2]exprNode
+
+func (n exprAnd) eval(env *exprEnv) exprValue {
+	left := n[0].eval(env)
+	if left == exprFalse {
+		return exprFalse
+	}
+	right := n[1].eval(env)
+	if right < left {
+		return right
+	}
+	return left
+}
+
+type exprOr [2]exprNode
+
+func (n exprOr) eval(env *exprEnv) exprValue {
+	left := n[0].eval(env)
+	if left == exprTrue {
+		return exprTrue
+	}
+	right := n[1].eval(env)
+	if right > left {
+		return right
+	}
+	return left
+}
+
+type exprNot struct {
+	node exprNode
+}
+
+func (n exprNot) eval(env *exprEnv) exprValue {
+	return exprTrue - n.node.eval(env)
+}
+
+type exprCompare struct {
+	attr  string
+	op    string
+	value string
+}
+
+func (n exprCompare) eval(env *exprEnv) exprValue {
+	values, known := env.lookup(n.attr)
+	if !known {
+		return exprUnknown
+	}
+	found := false
+	for _, value := range values {
+		if n.op == "==" || n.op == "!=" {
+			found = value == n.value
+		} else {
+			found = matchGlob(n.value, value)
+		}
+		if found {
+			break
+		}
+	}
+	return exprBool(found == (n.op == "==" || n.op == "=~"))
+}
+
+// compileExpr parses a filter expression
+func compileExpr(expr string) (exprNode, error) {
+	p := &exprParser{input: expr}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return node, nil
+}
+
+// exprParser is a recursive descent parser of filter expressions
+type exprParser struct {
+	input string
+	pos   int
+	tok   string // current token, empty at the end of input
+	str   bool   // whether tok is a quoted string
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return errors.New("bad filter.expr: " + fmt.Sprintf(format, args...) + " at offset " + strconv.Itoa(p.pos))
+}
+
+func isAttrChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '.' || c == '_' || c == '-' || c == '/'
+}
+
+// next reads the next token of the input
+func (p *exprParser) next() error {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	p.str = false
+	if p.pos == len(p.input) {
+		p.tok = ""
+		return nil
+	}
+	rest := p.input[p.pos:]
+	for _, op := range []string{"&&", "||", "==", "!=", "=~", "!~", "!", "(", ")"} {
+		if strings.HasPrefix(rest, op) {
+			p.tok = op
+			p.pos += len(op)
+			return nil
+		}
+	}
+	if rest[0] == '"' {
+		end := 1
+		for ; end < len(rest) && rest[end] != '"'; end++ {
+			if rest[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(rest) {
+			return p.errorf("unterminated string")
+		}
+		value, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return p.errorf("bad string %s", rest[:end+1])
+		}
+		p.tok, p.str = value, true
+		p.pos += end + 1
+		return nil
+	}
+	end := 0
+	for end < len(rest) && isAttrChar(rest[end]) {
+		end++
+	}
+	if end == 0 {
+		return p.errorf("unexpected %q", rest[0])
+	}
+	p.tok = rest[:end]
+	p.pos += end
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "||" && !p.str {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = exprOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "&&" && !p.str {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = exprAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.str {
+		return p.parseCompare()
+	}
+	switch p.tok {
+	case "!":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{node}, nil
+	case "(":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" || p.str {
+			return nil, p.errorf("missing )")
+		}
+		return node, p.next()
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	attr := p.tok
+	if p.str || !isExprAttr(attr) {
+		return nil, p.errorf("unknown attribute %q", attr)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	op := p.tok
+	if p.str || op != "==" && op != "!=" && op != "=~" && op != "!~" {
+		return nil, p.errorf("expected comparison after %s", attr)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if !p.str {
+		return nil, p.errorf("expected string after %s %s", attr, op)
+	}
+	value := p.tok
+	if op == "=~" || op == "!~" {
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, p.errorf("bad pattern %q", value)
+		}
+	}
+	return exprCompare{attr, op, value}, p.next()
+}
+
+func isExprAttr(attr string) bool {
+	switch attr {
+	case "id", "name", "image", "project", "service", "network", "source", "data":
+		return true
+	}
+	return strings.HasPrefix(attr, "label.") && len(attr) > len("label.")
+}
@@ -0,0 +1,105 @@
+package router
+
+import (
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestExprMatchContainer(t *testing.T) {
+	route := &Route{FilterExpr: `name!~"*-sidecar" && (label.team=="a" || label.team=="b")`}
+	if err := route.setupMatch(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		team     string
+		expected bool
+	}{
+		{"api", "a", true},
+		{"worker", "b", true},
+		{"api", "c", false},
+		{"api-sidecar", "a", false},
+	} {
+		labels := map[string]string{"team": tc.team}
+		if match := route.MatchContainer("8dfafdbc3a40", tc.name, labels); match != tc.expected {
+			t.Errorf("expected match %v for %s team %s got %v", tc.expected, tc.name, tc.team, match)
+		}
+	}
+	if !route.MultiContainer() {
+		t.Error("expected route with an expression to match multiple containers")
+	}
+}
+
+func TestExprMatchMessage(t *testing.T) {
+	route := &Route{FilterExpr: `label.team=="a" && (source=="stderr" || data=~"*ERROR*")`}
+	if err := route.setupMatch(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	// source and data are unknown when matching containers
+	if !route.MatchContainer("8dfafdbc3a40", "api", map[string]string{"team": "a"}) {
+		t.Error("expected container of team a to match")
+	}
+	if route.MatchContainer("8dfafdbc3a40", "api", map[string]string{"team": "b"}) {
+		t.Error("expected container of team b not to match")
+	}
+	container := &docker.Container{
+		ID:     "8dfafdbc3a40",
+		Name:   "/api",
+		Config: &docker.Config{Labels: map[string]string{"team": "a"}},
+	}
+	for _, tc := range []struct {
+		source   string
+		data     string
+		expected bool
+	}{
+		{"stderr", "panic", true},
+		{"stdout", "ERROR failed", true},
+		{"stdout", "INFO started", false},
+	} {
+		msg := &Message{Container: container, Source: tc.source, Data: tc.data}
+		if match := route.MatchMessage(msg); match != tc.expected {
+			t.Errorf("expected match %v for %s %q got %v", tc.expected, tc.source, tc.data, match)
+		}
+	}
+}
+
+func TestExprNot(t *testing.T) {
+	node, err := compileExpr(`!(name=="a" || data=="x")`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, tc := range []struct {
+		env      *exprEnv
+		expected exprValue
+	}{
+		{&exprEnv{container: true, name: "a"}, exprFalse},
+		{&exprEnv{container: true, name: "b"}, exprUnknown},
+		{&exprEnv{container: true, name: "b", message: &Message{Data: "y"}}, exprTrue},
+	} {
+		if value := node.eval(tc.env); value != tc.expected {
+			t.Errorf("expected %v for %+v got %v", tc.expected, tc.env, value)
+		}
+	}
+}
+
+func TestExprCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`name`,
+		`name=="a" &&`,
+		`(name=="a"`,
+		`name=="a")`,
+		`tag=="latest"`,
+		`label.=="a"`,
+		`name==a`,
+		`name=="a`,
+		`name=~"[a"`,
+		`name="a"`,
+		`"a"=="a"`,
+	} {
+		if _, err := compileExpr(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
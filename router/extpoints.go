@@ -328,3 +328,45 @@ func (ep *logRouterExt) Names() []string {
 	}
 	return names
 }
+
+// LogFilterFactory
+
+var LogFilterFactories = &logFilterFactoryExt{
+	newExtensionPoint(new(LogFilterFactory)),
+}
+
+type logFilterFactoryExt struct {
+	*extensionPoint
+}
+
+func (ep *logFilterFactoryExt) Unregister(name string) bool {
+	return ep.unregister(name)
+}
+
+func (ep *logFilterFactoryExt) Register(component LogFilterFactory, name string) bool {
+	return ep.register(component, name)
+}
+
+func (ep *logFilterFactoryExt) Lookup(name string) (LogFilterFactory, bool) {
+	ext, ok := ep.lookup(name)
+	if !ok {
+		return nil, ok
+	}
+	return ext.(LogFilterFactory), ok
+}
+
+func (ep *logFilterFactoryExt) All() map[string]LogFilterFactory {
+	all := make(map[string]LogFilterFactory)
+	for k, v := range ep.all() {
+		all[k] = v.(LogFilterFactory)
+	}
+	return all
+}
+
+func (ep *logFilterFactoryExt) Names() []string {
+	var names []string
+	for k := range ep.all() {
+		names = append(names, k)
+	}
+	return names
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"errors"
+	"strings"
+)
+
+// setupFilters builds the chain of filters of a route: its parse stage
+// followed by the filters named in its filters option
+func (r *Route) setupFilters() error {
+	r.filters = nil
+	parse, err := newParseFilter(r)
+	if err != nil {
+		return err
+	}
+	if parse != nil {
+		r.filters = append(r.filters, parse)
+	}
+	if r.Options["filters"] == "" {
+		return nil
+	}
+	for _, name := range strings.Split(r.Options["filters"], ",") {
+		factory, found := LogFilterFactories.Lookup(strings.TrimSpace(name))
+		if !found {
+			return errors.New("bad filter: " + name)
+		}
+		filter, err := factory(r)
+		if err != nil {
+			return err
+		}
+		r.filters = append(r.filters, filter)
+	}
+	return nil
+}
+
+// filterStream returns a logstream of the messages of in passed through the
+// filters of the route, in order
+func (r *Route) filterStream(in chan *Message) chan *Message {
+	out := make(chan *Message)
+	go func() {
+		defer close(out)
+		for queued := range in {
+			msg := queued
+			for _, filter := range r.filters {
+				if msg = filter.Filter(msg); msg == nil {
+					break
+				}
+			}
+			if msg == nil {
+				// there is nothing left to deliver
+				r.MarkDelivered(queued)
+				continue
+			}
+			out <- msg
+		}
+	}()
+	return out
+}
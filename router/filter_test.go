@@ -0,0 +1,80 @@
+package router
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type upperFilter struct{}
+
+func (f *upperFilter) Filter(message *Message) *Message {
+	upper := *message
+	upper.Data = strings.ToUpper(message.Data)
+	return &upper
+}
+
+type dropFilter string
+
+func (f dropFilter) Filter(message *Message) *Message {
+	if strings.Contains(message.Data, string(f)) {
+		return nil
+	}
+	return message
+}
+
+func init() {
+	LogFilterFactories.Register(func(route *Route) (LogFilter, error) {
+		return &upperFilter{}, nil
+	}, "test-upper")
+	LogFilterFactories.Register(func(route *Route) (LogFilter, error) {
+		if route.Options["drop"] == "" {
+			return nil, errors.New("drop option is required")
+		}
+		return dropFilter(route.Options["drop"]), nil
+	}, "test-drop")
+}
+
+func TestFilterSetupFilters(t *testing.T) {
+	route := &Route{Options: map[string]string{"parse": "json", "filters": "test-upper,test-drop", "drop": "x"}}
+	if err := route.setupFilters(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(route.filters) != 3 {
+		t.Errorf("expected parse stage and 2 filters, got %d filters", len(route.filters))
+	}
+	for _, opts := range []map[string]string{
+		{"filters": "unknown"},
+		{"filters": "test-drop"},
+		{"parse": "unknown"},
+	} {
+		if err := (&Route{Options: opts}).setupFilters(); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
+
+func TestFilterStream(t *testing.T) {
+	route := &Route{Options: map[string]string{"filters": "test-drop,test-upper", "drop": "noise"}}
+	if err := route.setupFilters(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	in := make(chan *Message, 3)
+	out := route.filterStream(in)
+	original := &Message{Data: "hello"}
+	in <- original
+	in <- &Message{Data: "some noise"}
+	in <- &Message{Data: "world"}
+	close(in)
+
+	var received []string
+	for msg := range out {
+		received = append(received, msg.Data)
+	}
+	if len(received) != 2 || received[0] != "HELLO" || received[1] != "WORLD" {
+		t.Errorf("expected [HELLO WORLD] got %v", received)
+	}
+	if original.Data != "hello" {
+		t.Error("expected original message to be unchanged")
+	}
+}
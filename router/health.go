@@ -0,0 +1,143 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// States of the adapter of a route reported by health checks
+const (
+	RouteConnected = "connected"
+	RouteRetrying  = "retrying"
+	RouteFailed    = "failed"
+)
+
+// States of the Docker event listener of the pump
+const (
+	EventsStarting  = "starting"
+	EventsListening = "listening"
+	EventsClosed    = "closed"
+)
+
+const (
+	routeConnected uint32 = iota
+	routeRetrying
+	routeFailed
+)
+
+var routeStates = []string{RouteConnected, RouteRetrying, RouteFailed}
+
+const dockerPingTimeout = 5 * time.Second
+
+// routeHealth is the state of the adapter of a route. It is accessed
+// atomically.
+type routeHealth struct {
+	lastWrite int64 // unix nanoseconds, kept first for 64-bit alignment
+	state     uint32
+}
+
+// RouteHealth is the state of the adapter of a route and the time it last
+// wrote messages successfully
+type RouteHealth struct {
+	ID        string     `json:"id"`
+	Adapter   string     `json:"adapter"`
+	Address   string     `json:"address"`
+	State     string     `json:"state"`
+	LastWrite *time.Time `json:"last_write,omitempty"`
+	Critical  bool       `json:"critical"`
+}
+
+// Health returns the state of the adapter of a route. Adapters are
+// connected once created, retrying while they retry a failed write, and
+// failed after giving up on one until they write successfully again.
+func (r *Route) Health() RouteHealth {
+	health := RouteHealth{
+		ID:       r.ID,
+		Adapter:  r.Adapter,
+		Address:  r.Address,
+		State:    routeStates[atomic.LoadUint32(&r.health.state)],
+		Critical: r.Critical(),
+	}
+	if nanos := atomic.LoadInt64(&r.health.lastWrite); nanos != 0 {
+		t := time.Unix(0, nanos).UTC()
+		health.LastWrite = &t
+	}
+	return health
+}
+
+// Critical returns whether logspout is not ready while the route is failed,
+// unless the health.critical option is false
+func (r *Route) Critical() bool {
+	return r.Options["health.critical"] != "false"
+}
+
+// MarkWritten records a successful write of the route's adapter. Adapters
+// pass the messages written, so that the checkpoints of their containers
+// only move past delivered messages.
+func (r *Route) MarkWritten(messages ...*Message) {
+	atomic.StoreInt64(&r.health.lastWrite, time.Now().UnixNano())
+	atomic.StoreUint32(&r.health.state, routeConnected)
+	r.MarkDelivered(messages...)
+}
+
+func (r *Route) setState(state uint32) {
+	atomic.StoreUint32(&r.health.state, state)
+}
+
+// Retry is Retry counting the retries of the route's adapter and marking
+// the route written with messages, or failed, once fn succeeds or is given
+// up on
+func (r *Route) Retry(retries int, fn func() error, messages ...*Message) error {
+	err := retry(retries, fn, r.CountRetry)
+	if err != nil {
+		r.setState(routeFailed)
+	} else {
+		r.MarkWritten(messages...)
+	}
+	return err
+}
+
+// PumpHealth is the state of the pump's Docker event listener
+type PumpHealth struct {
+	Events      string     `json:"events"`
+	EventsError string     `json:"events_error,omitempty"`
+	LastEvent   *time.Time `json:"last_event,omitempty"`
+}
+
+// Health returns the state of the pump's Docker event listener, started by
+// Run
+func (p *LogsPump) Health() PumpHealth {
+	p.mu.Lock()
+	health := PumpHealth{Events: p.events, EventsError: p.eventsErr}
+	p.mu.Unlock()
+	if health.Events == "" {
+		health.Events = EventsStarting
+	}
+	if nanos := atomic.LoadInt64(&p.lastEvent); nanos != 0 {
+		t := time.Unix(0, nanos).UTC()
+		health.LastEvent = &t
+	}
+	return health
+}
+
+// Ping returns an error unless the Docker API is reachable
+func (p *LogsPump) Ping() error {
+	if p.client == nil {
+		return errors.New("no docker client")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dockerPingTimeout)
+	defer cancel()
+	return p.client.PingWithContext(ctx)
+}
+
+func (p *LogsPump) setEvents(state string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = state
+	p.eventsErr = ""
+	if err != nil {
+		p.eventsErr = err.Error()
+	}
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Docker log drivers split lines longer than this into partial messages
+	dockerPartialSize = 16 * 1024
+	// length of the longest RFC3339Nano timestamp and the space following it
+	maxTimestampLen = len("2006-01-02T15:04:05.999999999-07:00 ")
+
+	defaultMaxLineLength    = 1024 * 1024
+	defaultTruncationMarker = "[truncated]"
+)
+
+// lineReader reads log lines from a Docker log stream requested with
+// timestamps. It joins lines Docker split into partial messages and truncates
+// lines longer than max bytes, so memory use is bounded.
+type lineReader struct {
+	buf    *bufio.Reader
+	max    int
+	marker string
+}
+
+func newLineReader(input io.Reader, max int, marker string) *lineReader {
+	return &lineReader{
+		buf:    bufio.NewReader(input),
+		max:    max,
+		marker: marker,
+	}
+}
+
+// ReadLine returns the time and content of the next log line
+func (r *lineReader) ReadLine() (time.Time, string, error) {
+	limit := 0
+	if r.max > 0 {
+		// leave room for the timestamps of every partial message
+		limit = r.max + (r.max/dockerPartialSize+2)*maxTimestampLen
+	}
+	raw, truncated, err := r.readRaw(limit)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	msgTime, data, ok := parseTimestamp(raw)
+	if !ok {
+		msgTime = time.Now()
+	} else {
+		data = joinPartials(data)
+	}
+	if r.max > 0 && len(data) > r.max {
+		cut := r.max
+		for cut > 0 && !utf8.RuneStart(data[cut]) {
+			cut--
+		}
+		data = data[:cut]
+		truncated = true
+	}
+	if truncated {
+		data += r.marker
+	}
+	return msgTime, data, nil
+}
+
+// readRaw reads up to the next newline, keeping at most limit bytes when
+// limit is positive and discarding the rest of the line
+func (r *lineReader) readRaw(limit int) (string, bool, error) {
+	var line []byte
+	truncated := false
+	for {
+		frag, err := r.buf.ReadSlice('\n')
+		if limit > 0 && len(line)+len(frag) > limit {
+			frag = frag[:limit-len(line)]
+			truncated = true
+		}
+		line = append(line, frag...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimSuffix(string(line), "\n"), truncated, nil
+	}
+}
+
+// parseTimestamp separates the timestamp Docker prefixes log lines with from
+// the rest of the line
+func parseTimestamp(line string) (time.Time, string, bool) {
+	i := strings.IndexByte(line, ' ')
+	if i <= 0 || i >= maxTimestampLen {
+		return time.Time{}, line, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, line[:i])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return t, line[i+1:], true
+}
+
+// joinPartials removes the timestamps Docker writes in the middle of lines it
+// split into partial messages, at every dockerPartialSize bytes of content
+func joinPartials(data string) string {
+	for i := dockerPartialSize; i < len(data); i += dockerPartialSize {
+		if _, _, ok := parseTimestamp(data[i:]); !ok {
+			break
+		}
+		data = data[:i] + data[i+strings.IndexByte(data[i:], ' ')+1:]
+	}
+	return data
+}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLinesParseTimestamp(t *testing.T) {
+	lines := []struct {
+		in   string
+		time string
+		data string
+	}{
+		{"2021-02-03T04:05:06.123456789Z hello world", "2021-02-03T04:05:06.123456789Z", "hello world"},
+		{"2021-02-03T04:05:06Z ", "2021-02-03T04:05:06Z", ""},
+		{"2021-02-03T04:05:06.5+01:00 x", "2021-02-03T04:05:06.5+01:00", "x"},
+	}
+	for _, line := range lines {
+		expected, _ := time.Parse(time.RFC3339Nano, line.time)
+		msgTime, data, ok := parseTimestamp(line.in)
+		if !ok || !msgTime.Equal(expected) || data != line.data {
+			t.Errorf("expected (%v, %q) got (%v, %q)", expected, line.data, msgTime, data)
+		}
+	}
+	for _, line := range []string{"no timestamp here", "", "2021-02-03T04:05:06Z"} {
+		if _, data, ok := parseTimestamp(line); ok || data != line {
+			t.Errorf("expected no timestamp in %q", line)
+		}
+	}
+}
+
+func TestLinesReadLine(t *testing.T) {
+	input := "2021-02-03T04:05:06Z first\n" +
+		"no timestamp\n" +
+		"2021-02-03T04:05:07Z \n"
+	lines := newLineReader(strings.NewReader(input), 0, defaultTruncationMarker)
+
+	msgTime, data, err := lines.ReadLine()
+	if err != nil || data != "first" || !msgTime.Equal(time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)) {
+		t.Errorf("unexpected first line: %v %q %v", msgTime, data, err)
+	}
+	before := time.Now()
+	msgTime, data, err = lines.ReadLine()
+	if err != nil || data != "no timestamp" || msgTime.Before(before) {
+		t.Errorf("expected current time for line without timestamp, got: %v %q %v", msgTime, data, err)
+	}
+	if _, data, err = lines.ReadLine(); err != nil || data != "" {
+		t.Errorf("expected empty line, got: %q %v", data, err)
+	}
+	if _, _, err = lines.ReadLine(); err != io.EOF {
+		t.Errorf("expected EOF got: %v", err)
+	}
+}
+
+func TestLinesJoinPartials(t *testing.T) {
+	long := strings.Repeat("a", dockerPartialSize) + strings.Repeat("b", dockerPartialSize) + "c"
+	input := "2021-02-03T04:05:06.1Z " + long[:dockerPartialSize] +
+		"2021-02-03T04:05:06.2Z " + long[dockerPartialSize:2*dockerPartialSize] +
+		"2021-02-03T04:05:06.3Z " + long[2*dockerPartialSize:] + "\n" +
+		"2021-02-03T04:05:07Z next\n"
+	lines := newLineReader(strings.NewReader(input), 0, defaultTruncationMarker)
+
+	msgTime, data, err := lines.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != long {
+		t.Errorf("expected partial messages to be joined, got %d bytes", len(data))
+	}
+	if expected := time.Date(2021, 2, 3, 4, 5, 6, 100000000, time.UTC); !msgTime.Equal(expected) {
+		t.Errorf("expected time of first partial message %v got %v", expected, msgTime)
+	}
+	if _, data, _ = lines.ReadLine(); data != "next" {
+		t.Errorf("expected next line, got %q", data)
+	}
+}
+
+func TestLinesTruncate(t *testing.T) {
+	input := "2021-02-03T04:05:06Z " + strings.Repeat("x", 100) + "\n" +
+		"2021-02-03T04:05:07Z short\n" +
+		"2021-02-03T04:05:08Z " + strings.Repeat("é", 10) + "\n"
+	lines := newLineReader(strings.NewReader(input), 10, "...")
+
+	if _, data, _ := lines.ReadLine(); data != "xxxxxxxxxx..." {
+		t.Errorf("expected truncated line, got %q", data)
+	}
+	if _, data, _ := lines.ReadLine(); data != "short" {
+		t.Errorf("expected line after truncated one to be intact, got %q", data)
+	}
+	if _, data, _ := lines.ReadLine(); data != "ééééé..." {
+		t.Errorf("expected truncation on a rune boundary, got %q", data)
+	}
+
+	// a line much longer than the bufio buffer is discarded as it is read
+	input = "2021-02-03T04:05:06Z " + strings.Repeat("y", 10*dockerPartialSize) + "\n"
+	lines = newLineReader(strings.NewReader(input), dockerPartialSize, defaultTruncationMarker)
+	if _, data, _ := lines.ReadLine(); data != strings.Repeat("y", dockerPartialSize)+defaultTruncationMarker {
+		t.Errorf("expected line truncated to %d bytes, got %d bytes", dockerPartialSize, len(data))
+	}
+}
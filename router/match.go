@@ -0,0 +1,106 @@
+package router
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// setupMatch compiles the content filters of a route
+func (r *Route) setupMatch() error {
+	r.match, r.exclude, r.expr = nil, nil, nil
+	if r.FilterMatch != "" {
+		match, err := regexp.Compile(r.FilterMatch)
+		if err != nil {
+			return errors.New("bad filter.match: " + err.Error())
+		}
+		r.match = match
+	}
+	if r.FilterExclude != "" {
+		exclude, err := regexp.Compile(r.FilterExclude)
+		if err != nil {
+			return errors.New("bad filter.exclude: " + err.Error())
+		}
+		r.exclude = exclude
+	}
+	if r.FilterExpr != "" {
+		expr, err := compileExpr(r.FilterExpr)
+		if err != nil {
+			return err
+		}
+		r.expr = expr
+	}
+	return nil
+}
+
+// matchContent returns whether the data of a message passes the content filters of a route
+func (r *Route) matchContent(data string) bool {
+	if r.match != nil && !r.match.MatchString(data) {
+		return false
+	}
+	if r.exclude != nil && r.exclude.MatchString(data) {
+		return false
+	}
+	return true
+}
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	swarmServiceLabel   = "com.docker.swarm.service.name"
+)
+
+// matchGlob returns whether value matches a wildcard pattern
+func matchGlob(pattern, value string) bool {
+	match, err := path.Match(pattern, value)
+	return err == nil && match
+}
+
+// matchAny returns whether any of values matches a wildcard pattern
+func matchAny(pattern string, values []string) bool {
+	for _, value := range values {
+		if matchGlob(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// containerImages returns the image a container was created from, and the
+// same image without its tag or digest, so filters on the repository alone
+// match every tag
+func containerImages(container *docker.Container) []string {
+	if container.Config == nil || container.Config.Image == "" {
+		return nil
+	}
+	image := container.Config.Image
+	repository := image
+	if i := strings.IndexByte(repository, '@'); i >= 0 {
+		repository = repository[:i]
+	}
+	if i := strings.LastIndexByte(repository, ':'); i > strings.LastIndexByte(repository, '/') {
+		repository = repository[:i]
+	}
+	if repository == image {
+		return []string{image}
+	}
+	return []string{image, repository}
+}
+
+// containerNetworks returns the names of the networks a container is attached to
+func containerNetworks(container *docker.Container) []string {
+	var networks []string
+	if container.NetworkSettings != nil {
+		for name := range container.NetworkSettings.Networks {
+			networks = append(networks, name)
+		}
+	}
+	if len(networks) == 0 && container.HostConfig != nil && container.HostConfig.NetworkMode != "" {
+		networks = append(networks, container.HostConfig.NetworkMode)
+	}
+	sort.Strings(networks)
+	return networks
+}
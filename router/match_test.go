@@ -0,0 +1,151 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestMatchMessageContent(t *testing.T) {
+	route := &Route{FilterMatch: `ERROR|WARN`, FilterExclude: `healthcheck`}
+	if err := route.setupMatch(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for data, expected := range map[string]bool{
+		"ERROR database unavailable":  true,
+		"WARN slow request":           true,
+		"INFO started":                false,
+		"ERROR healthcheck timed out": false,
+	} {
+		if match := route.MatchMessage(&Message{Data: data}); match != expected {
+			t.Errorf("expected match %v for %q got %v", expected, data, match)
+		}
+	}
+}
+
+func TestMatchMessageExcludeOnly(t *testing.T) {
+	route := &Route{FilterExclude: `^GET /health`, FilterSources: []string{"stdout"}}
+	if err := route.setupMatch(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if route.MatchMessage(&Message{Source: "stdout", Data: "GET /health 200"}) {
+		t.Error("expected health check message not to match")
+	}
+	if !route.MatchMessage(&Message{Source: "stdout", Data: "GET /users 200"}) {
+		t.Error("expected message to match")
+	}
+	if route.MatchMessage(&Message{Source: "stderr", Data: "GET /users 200"}) {
+		t.Error("expected stderr message not to match")
+	}
+}
+
+func TestMatchSetupBadPattern(t *testing.T) {
+	for _, route := range []*Route{{FilterMatch: "("}, {FilterExclude: "["}} {
+		if err := route.setupMatch(); err == nil {
+			t.Errorf("expected error for route %+v", route)
+		}
+	}
+}
+
+func TestMatchAddFromURI(t *testing.T) {
+	AdapterFactories.Register(newDummyAdapter, "dummy")
+	rm := &RouteManager{routes: make(map[string]*Route)}
+	if err := rm.AddFromURI("dummy://localhost?filter.match=ERROR&filter.exclude=healthcheck"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	routes, _ := rm.GetAll()
+	if len(routes) != 1 || routes[0].FilterMatch != "ERROR" || routes[0].FilterExclude != "healthcheck" {
+		t.Errorf("expected content filters to be set, got %+v", routes)
+	}
+	if err := rm.AddFromURI("dummy://localhost?filter.image=nginx&filter.project=shop&filter.service=web&filter.network=backend"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, route := range rm.routes {
+		if route.FilterImage == "nginx" && (route.FilterProject != "shop" || route.FilterService != "web" || route.FilterNetwork != "backend") {
+			t.Errorf("expected container filters to be set, got %+v", route)
+		}
+	}
+	if err := rm.AddFromURI("dummy://localhost?filter.match=("); err == nil {
+		t.Error("expected error for bad filter.match")
+	}
+}
+
+func newTestDockerContainer(image string, labels map[string]string, networks ...string) *docker.Container {
+	container := &docker.Container{
+		ID:              "8dfafdbc3a40",
+		Name:            "/app",
+		Config:          &docker.Config{Image: image, Labels: labels},
+		NetworkSettings: &docker.NetworkSettings{Networks: make(map[string]docker.ContainerNetwork)},
+	}
+	for _, network := range networks {
+		container.NetworkSettings.Networks[network] = docker.ContainerNetwork{}
+	}
+	return container
+}
+
+func TestMatchDockerContainer(t *testing.T) {
+	web := newTestDockerContainer("nginx:1.21", map[string]string{
+		composeProjectLabel: "shop",
+		swarmServiceLabel:   "shop_web",
+	}, "frontend", "backend")
+	db := newTestDockerContainer("registry.example.com/postgres@sha256:abc", map[string]string{
+		composeProjectLabel: "billing",
+	}, "backend")
+	for _, tc := range []struct {
+		route *Route
+		web   bool
+		db    bool
+	}{
+		{&Route{FilterImage: "nginx"}, true, false},
+		{&Route{FilterImage: "nginx:1.*"}, true, false},
+		{&Route{FilterImage: "registry.example.com/*"}, false, true},
+		{&Route{FilterProject: "shop"}, true, false},
+		{&Route{FilterService: "shop_*"}, true, false},
+		{&Route{FilterNetwork: "backend"}, true, true},
+		{&Route{FilterNetwork: "front*"}, true, false},
+		{&Route{FilterNetwork: "backend", FilterProject: "billing"}, false, true},
+		{&Route{FilterExpr: `image=="nginx" || network=="none"`}, true, false},
+		{&Route{FilterExpr: `network!="frontend" && project=~"bill*"`}, false, true},
+	} {
+		if err := tc.route.setupMatch(); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if match := tc.route.MatchDockerContainer(web); match != tc.web {
+			t.Errorf("expected match %v for web container with route %+v", tc.web, tc.route)
+		}
+		if match := tc.route.MatchDockerContainer(db); match != tc.db {
+			t.Errorf("expected match %v for db container with route %+v", tc.db, tc.route)
+		}
+		if !tc.route.MultiContainer() {
+			t.Errorf("expected route %+v to match multiple containers", tc.route)
+		}
+	}
+}
+
+func TestMatchContainerImages(t *testing.T) {
+	for image, expected := range map[string][]string{
+		"nginx":                 {"nginx"},
+		"nginx:1.21":            {"nginx:1.21", "nginx"},
+		"localhost:5000/app":    {"localhost:5000/app"},
+		"localhost:5000/app:v2": {"localhost:5000/app:v2", "localhost:5000/app"},
+		"app@sha256:abc":        {"app@sha256:abc", "app"},
+		"":                      nil,
+	} {
+		container := newTestDockerContainer(image, nil)
+		if images := containerImages(container); !reflect.DeepEqual(images, expected) {
+			t.Errorf("expected %v for %q got %v", expected, image, images)
+		}
+	}
+}
+
+func TestMatchContainerNetworks(t *testing.T) {
+	container := newTestDockerContainer("nginx", nil, "b", "a")
+	if networks := containerNetworks(container); !reflect.DeepEqual(networks, []string{"a", "b"}) {
+		t.Errorf("expected [a b] got %v", networks)
+	}
+	container = &docker.Container{HostConfig: &docker.HostConfig{NetworkMode: "host"}}
+	if networks := containerNetworks(container); !reflect.DeepEqual(networks, []string{"host"}) {
+		t.Errorf("expected [host] got %v", networks)
+	}
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// routeCounters count the messages queued for a route and the failures of
+// its adapter. They are accessed atomically.
+type routeCounters struct {
+	messages    uint64
+	bytes       uint64
+	writeErrors uint64
+	reconnects  uint64
+	retries     uint64
+}
+
+// RouteCounters are the totals of the messages and failures of a route
+type RouteCounters struct {
+	Messages    uint64 `json:"messages"`
+	Bytes       uint64 `json:"bytes"`
+	Dropped     uint64 `json:"dropped"`
+	WriteErrors uint64 `json:"write_errors"`
+	Reconnects  uint64 `json:"reconnects"`
+	Retries     uint64 `json:"retries"`
+}
+
+// Counters returns the totals of the messages and failures of a route
+func (r *Route) Counters() RouteCounters {
+	return RouteCounters{
+		Messages:    atomic.LoadUint64(&r.counters.messages),
+		Bytes:       atomic.LoadUint64(&r.counters.bytes),
+		Dropped:     atomic.LoadUint64(&r.dropped),
+		WriteErrors: atomic.LoadUint64(&r.counters.writeErrors),
+		Reconnects:  atomic.LoadUint64(&r.counters.reconnects),
+		Retries:     atomic.LoadUint64(&r.counters.retries),
+	}
+}
+
+// CountWriteError counts a write of the route's adapter that failed for good,
+// marking the route failed
+func (r *Route) CountWriteError() {
+	atomic.AddUint64(&r.counters.writeErrors, 1)
+	r.setState(routeFailed)
+}
+
+// CountReconnect counts a connection of the route's adapter made again after
+// it was lost, marking the route connected
+func (r *Route) CountReconnect() {
+	atomic.AddUint64(&r.counters.reconnects, 1)
+	r.setState(routeConnected)
+}
+
+// CountRetry counts an attempt of the route's adapter to write again after
+// a failure, marking the route retrying
+func (r *Route) CountRetry() {
+	atomic.AddUint64(&r.counters.retries, 1)
+	r.setState(routeRetrying)
+}
+
+func (r *Route) countMessage(msg *Message) {
+	atomic.AddUint64(&r.counters.messages, 1)
+	atomic.AddUint64(&r.counters.bytes, uint64(len(msg.Data)))
+	r.markQueued(msg)
+}
+
+// ContainerCounters are the totals of the log lines pumped from a container
+type ContainerCounters struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// Containers returns the totals of the containers logs are being pumped
+// from, sorted by name
+func (p *LogsPump) Containers() []ContainerCounters {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	containers := make([]ContainerCounters, 0, len(p.pumps))
+	for id, pump := range p.pumps {
+		containers = append(containers, ContainerCounters{
+			ID:       id,
+			Name:     strings.TrimPrefix(pump.container.Name, "/"),
+			Messages: atomic.LoadUint64(&pump.messages),
+			Bytes:    atomic.LoadUint64(&pump.bytes),
+		})
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted replaces the values of secret options when routes are shown
+const redacted = "REDACTED"
+
+// secretOptions are the names of options holding credentials, and prefixes
+// of names when they end with a dot
+var secretOptions []string
+
+// SecretOptions registers the names of options holding credentials, like
+// passwords and tokens, so that they are redacted when routes are shown. A
+// name ending with a dot registers every option with that prefix. It is meant
+// to be called by adapters from their init functions.
+func SecretOptions(names ...string) {
+	secretOptions = append(secretOptions, names...)
+}
+
+func isSecretOption(name string) bool {
+	for _, secret := range secretOptions {
+		if name == secret || (strings.HasSuffix(secret, ".") && strings.HasPrefix(name, secret)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactedOptions returns a copy of the options of a route with the values of
+// secret options redacted, for logging or serving the route
+func (r *Route) RedactedOptions() map[string]string {
+	if r.Options == nil {
+		return nil
+	}
+	options := make(map[string]string, len(r.Options))
+	for name, value := range r.Options {
+		if value != "" && isSecretOption(name) {
+			value = redacted
+		}
+		options[name] = value
+	}
+	return options
+}
+
+// IntOption returns the value of an integer option of a route, or dfault when it isn't set
+func (r *Route) IntOption(name string, dfault int) (int, error) {
+	s := r.Options[name]
+	if s == "" {
+		return dfault, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errors.New("bad " + name + ": " + s)
+	}
+	return n, nil
+}
+
+// DurationOption returns the value of a duration option of a route, such as
+// 500ms or 5s, or dfault when it isn't set
+func (r *Route) DurationOption(name string, dfault time.Duration) (time.Duration, error) {
+	s := r.Options[name]
+	if s == "" {
+		return dfault, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.New("bad " + name + ": " + s)
+	}
+	return d, nil
+}
+
+// SizeOption returns the value of a byte size option of a route, such as
+// 512KB, or dfault when it isn't set
+func (r *Route) SizeOption(name string, dfault int64) (int64, error) {
+	s := r.Options[name]
+	if s == "" {
+		return dfault, nil
+	}
+	n, err := parseSize(s)
+	if err != nil || n < 0 {
+		return 0, errors.New("bad " + name + ": " + s)
+	}
+	return n, nil
+}
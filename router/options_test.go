@@ -0,0 +1,29 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactedOptions(t *testing.T) {
+	defer func(secrets []string) { secretOptions = secrets }(secretOptions)
+	SecretOptions("test.password", "test.header.")
+	route := &Route{Options: map[string]string{
+		"test.password":             "secret",
+		"test.header.Authorization": "Bearer secret",
+		"test.username":             "logspout",
+		"test.passwords":            "shown",
+	}}
+	expected := map[string]string{
+		"test.password":             redacted,
+		"test.header.Authorization": redacted,
+		"test.username":             "logspout",
+		"test.passwords":            "shown",
+	}
+	if options := route.RedactedOptions(); !reflect.DeepEqual(options, expected) {
+		t.Errorf("expected %v got %v", expected, options)
+	}
+	if route.Options["test.password"] != "secret" {
+		t.Error("expected the route options to be left unchanged")
+	}
+}
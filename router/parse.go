@@ -0,0 +1,163 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// parseFilter is a LogFilter setting the fields of messages to those parsed from their data
+type parseFilter func(data string) map[string]interface{}
+
+// Filter returns a copy of message with the parsed fields, or message itself
+// when its data can't be parsed
+func (parse parseFilter) Filter(message *Message) *Message {
+	fields := parse(message.Data)
+	if fields == nil {
+		return message
+	}
+	parsed := *message
+	parsed.Fields = fields
+	return &parsed
+}
+
+// newParseFilter returns the parse stage configured by the parse options of a
+// route, or nil when it has none
+func newParseFilter(route *Route) (LogFilter, error) {
+	switch route.Options["parse"] {
+	case "":
+		return nil, nil
+	case "json":
+		return parseFilter(parseJSON), nil
+	case "logfmt":
+		return parseFilter(parseLogfmt), nil
+	case "regex":
+		pattern, err := regexp.Compile(route.Options["parse.pattern"])
+		if err != nil {
+			return nil, errors.New("bad parse.pattern: " + err.Error())
+		}
+		if !hasNamedGroup(pattern) {
+			return nil, errors.New("bad parse.pattern: no named groups")
+		}
+		return parseFilter(func(data string) map[string]interface{} {
+			return parseRegexp(pattern, data)
+		}), nil
+	default:
+		return nil, errors.New("bad parse: " + route.Options["parse"])
+	}
+}
+
+// parseJSON returns the fields of a JSON object
+func parseJSON(data string) map[string]interface{} {
+	if !strings.HasPrefix(strings.TrimSpace(data), "{") {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// parseLogfmt returns the fields of a logfmt line like: level=info msg="hello world".
+// Keys without a value are set to true.
+func parseLogfmt(data string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	pairs := 0
+	s := data
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			break
+		}
+		end := strings.IndexFunc(s, func(r rune) bool { return r == '=' || unicode.IsSpace(r) })
+		if end < 0 {
+			end = len(s)
+		}
+		key := s[:end]
+		s = s[end:]
+		if key == "" {
+			return nil
+		}
+		if !strings.HasPrefix(s, "=") {
+			fields[key] = true
+			continue
+		}
+		s = s[1:]
+		pairs++
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var ok bool
+			if value, s, ok = unquoteLogfmt(s); !ok {
+				return nil
+			}
+		} else {
+			end = strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		fields[key] = value
+	}
+	// plain text is not logfmt, even if each word reads as a key
+	if pairs == 0 {
+		return nil
+	}
+	return fields
+}
+
+// unquoteLogfmt reads a quoted value from the start of s, returning it and the rest of s
+func unquoteLogfmt(s string) (string, string, bool) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", false
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
+
+func hasNamedGroup(pattern *regexp.Regexp) bool {
+	for _, name := range pattern.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRegexp returns the named groups of pattern matched in data
+func parseRegexp(pattern *regexp.Regexp, data string) map[string]interface{} {
+	match := pattern.FindStringSubmatch(data)
+	if match == nil {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	for i, name := range pattern.SubexpNames() {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+	return fields
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNewParseFilter(t *testing.T) {
+	for _, opts := range []map[string]string{
+		{},
+		{"parse": "json"},
+		{"parse": "logfmt"},
+		{"parse": "regex", "parse.pattern": `^(?P<level>\w+):`},
+	} {
+		if _, err := newParseFilter(&Route{Options: opts}); err != nil {
+			t.Errorf("unexpected error for options %v: %v", opts, err)
+		}
+	}
+	for _, opts := range []map[string]string{
+		{"parse": "xml"},
+		{"parse": "regex", "parse.pattern": `(`},
+		{"parse": "regex", "parse.pattern": `^(\w+):`},
+	} {
+		if _, err := newParseFilter(&Route{Options: opts}); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	fields := parseJSON(`{"level":"info","msg":"hello","count":2}`)
+	expected := map[string]interface{}{"level": "info", "msg": "hello", "count": float64(2)}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v got %v", expected, fields)
+	}
+	for _, data := range []string{"plain text", `["a"]`, `{"broken"`} {
+		if fields := parseJSON(data); fields != nil {
+			t.Errorf("expected no fields for %q got %v", data, fields)
+		}
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	fields := parseLogfmt(`level=info msg="hello \"world\"" empty= debug`)
+	expected := map[string]interface{}{"level": "info", "msg": `hello "world"`, "empty": "", "debug": true}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v got %v", expected, fields)
+	}
+	for _, data := range []string{"plain text", `msg="unterminated`, "=value", ""} {
+		if fields := parseLogfmt(data); fields != nil {
+			t.Errorf("expected no fields for %q got %v", data, fields)
+		}
+	}
+}
+
+func TestParseRegexp(t *testing.T) {
+	filter, err := newParseFilter(&Route{Options: map[string]string{"parse": "regex", "parse.pattern": `^(?P<level>[A-Z]+) (?P<msg>.*)$`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := filter.Filter(&Message{Data: "WARN disk almost full"})
+	expected := map[string]interface{}{"level": "WARN", "msg": "disk almost full"}
+	if !reflect.DeepEqual(msg.Fields, expected) {
+		t.Errorf("expected %v got %v", expected, msg.Fields)
+	}
+	if msg := filter.Filter(&Message{Data: "lowercase"}); msg.Fields != nil {
+		t.Errorf("expected no fields got %v", msg.Fields)
+	}
+}
+
+func TestParseStreamDoesNotModifyMessages(t *testing.T) {
+	route := &Route{Options: map[string]string{"parse": "json"}}
+	if err := route.setupFilters(); err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan *Message, 2)
+	out := route.filterStream(in)
+	original := &Message{Data: `{"level":"error"}`}
+	in <- original
+	in <- &Message{Data: "not json"}
+	close(in)
+
+	parsed := <-out
+	if parsed == original || original.Fields != nil {
+		t.Error("expected parsed message to be a copy")
+	}
+	if parsed.Fields["level"] != "error" {
+		t.Errorf("expected level field 'error' got %v", parsed.Fields["level"])
+	}
+	if msg := <-out; msg.Fields != nil {
+		t.Errorf("expected no fields for non JSON data, got %v", msg.Fields)
+	}
+	if _, ok := <-out; ok {
+		t.Error("expected parsed stream to be closed")
+	}
+}
@@ -1,13 +1,14 @@
 package router
 
 import (
-	"bufio"
 	"errors"
 	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -134,12 +135,29 @@ type update struct {
 	pump *containerPump
 }
 
+func getMaxLineLengthFromEnv() int {
+	maxLineLength, err := strconv.Atoi(cfg.GetEnvDefault("MAX_LINE_LENGTH", strconv.Itoa(defaultMaxLineLength)))
+	assert(err, "Couldn't parse env var MAX_LINE_LENGTH")
+	return maxLineLength
+}
+
+func getCheckpointIntervalFromEnv() time.Duration {
+	checkpointInterval, err := time.ParseDuration(cfg.GetEnvDefault("CHECKPOINT_INTERVAL", "5s"))
+	assert(err, "Couldn't parse env var CHECKPOINT_INTERVAL. See https://golang.org/pkg/time/#ParseDuration for valid format.")
+	return checkpointInterval
+}
+
 // LogsPump is responsible for "pumping" logs to their configured destinations
 type LogsPump struct {
-	mu     sync.Mutex
-	pumps  map[string]*containerPump
-	routes map[chan *update]struct{}
-	client *docker.Client
+	lastEvent    int64 // accessed atomically, kept first for 64-bit alignment
+	mu           sync.Mutex
+	events       string
+	eventsErr    string
+	pumps        map[string]*containerPump
+	routes       map[chan *update]struct{}
+	client       *docker.Client
+	checkpointMu sync.Mutex
+	checkpoints  CheckpointFileStore
 }
 
 // Name returns the name of the pump
@@ -151,7 +169,19 @@ func (p *LogsPump) Name() string {
 func (p *LogsPump) Setup() error {
 	var err error
 	p.client, err = docker.NewClientFromEnv()
-	return err
+	if err != nil {
+		return err
+	}
+	// checkpoints are kept alongside persisted routes
+	persistPath := cfg.GetEnvDefault("ROUTESPATH", "/mnt/routes")
+	if _, err = os.Stat(persistPath); err == nil && getCheckpointIntervalFromEnv() > 0 {
+		checkpoints := persistPath + "/checkpoints"
+		if err = os.MkdirAll(checkpoints, 0700); err != nil {
+			return err
+		}
+		p.checkpoints = CheckpointFileStore(checkpoints)
+	}
+	return nil
 }
 
 func (p *LogsPump) rename(event *docker.APIEvents) {
@@ -174,8 +204,13 @@ func (p *LogsPump) Run() error {
 
 	containers, err := p.client.ListContainers(docker.ListContainersOptions{})
 	if err != nil {
+		p.setEvents(EventsClosed, err)
 		return err
 	}
+	if p.checkpoints != "" {
+		p.pruneCheckpoints()
+		go p.saveCheckpoints(getCheckpointIntervalFromEnv())
+	}
 	for idx := range containers {
 		p.pumpLogs(&docker.APIEvents{
 			ID:     normalID(containers[idx].ID),
@@ -185,9 +220,12 @@ func (p *LogsPump) Run() error {
 	events := make(chan *docker.APIEvents)
 	err = p.client.AddEventListener(events)
 	if err != nil {
+		p.setEvents(EventsClosed, err)
 		return err
 	}
+	p.setEvents(EventsListening, nil)
 	for event := range events {
+		atomic.StoreInt64(&p.lastEvent, time.Now().UnixNano())
 		debug("pump.Run() event:", normalID(event.ID), event.Status)
 		switch event.Status {
 		case pumpEventStatusStartName, pumpEventStatusRestartName:
@@ -198,7 +236,9 @@ func (p *LogsPump) Run() error {
 			go p.update(event)
 		}
 	}
-	return errors.New("docker event stream closed")
+	err = errors.New("docker event stream closed")
+	p.setEvents(EventsClosed, err)
+	return err
 }
 
 func (p *LogsPump) pumpLogs(event *docker.APIEvents, backlog bool, inactivityTimeout time.Duration) { //nolint:gocyclo
@@ -219,8 +259,12 @@ func (p *LogsPump) pumpLogs(event *docker.APIEvents, backlog bool, inactivityTim
 	}
 
 	var tail = cfg.GetEnvDefault("TAIL", "all")
-	var sinceTime time.Time
-	if backlog {
+	var sinceTime, resumeTime time.Time
+	if checkpoint, ok := p.checkpoint(id); ok {
+		debug("pump.pumpLogs():", id, "resuming from checkpoint:", checkpoint)
+		sinceTime = checkpoint
+		resumeTime = checkpoint
+	} else if backlog {
 		sinceTime = time.Unix(0, 0)
 	} else {
 		sinceTime = time.Now()
@@ -241,7 +285,13 @@ func (p *LogsPump) pumpLogs(event *docker.APIEvents, backlog bool, inactivityTim
 	}
 	outrd, outwr := io.Pipe()
 	errrd, errwr := io.Pipe()
-	p.pumps[id] = newContainerPump(container, outrd, errrd)
+	pump := newContainerPump(container, outrd, errrd)
+	if !resumeTime.IsZero() {
+		// Docker resumes at the start of the second of the checkpoint
+		pump.skipUntil = resumeTime.UnixNano()
+		pump.savedTime = pump.skipUntil
+	}
+	p.pumps[id] = pump
 	p.mu.Unlock()
 	p.update(event)
 	go func() {
@@ -254,6 +304,7 @@ func (p *LogsPump) pumpLogs(event *docker.APIEvents, backlog bool, inactivityTim
 				Stdout:            true,
 				Stderr:            true,
 				Follow:            true,
+				Timestamps:        true,
 				Tail:              tail,
 				Since:             sinceTime.Unix(),
 				InactivityTimeout: inactivityTimeout,
@@ -271,9 +322,10 @@ func (p *LogsPump) pumpLogs(event *docker.APIEvents, backlog bool, inactivityTim
 			}
 
 			container, err := p.client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: id})
+			removed := false
 			if err != nil {
-				_, four04 := err.(*docker.NoSuchContainer)
-				if !four04 {
+				_, removed = err.(*docker.NoSuchContainer)
+				if !removed {
 					assert(err, defaultPumpName)
 				}
 			} else if container.State.Running {
@@ -286,11 +338,97 @@ func (p *LogsPump) pumpLogs(event *docker.APIEvents, backlog bool, inactivityTim
 			p.mu.Lock()
 			delete(p.pumps, id)
 			p.mu.Unlock()
+			if removed {
+				p.removeCheckpoint(id)
+			} else {
+				p.saveCheckpoint(id, pump)
+			}
+			pump.forgetDelivery()
 			return
 		}
 	}()
 }
 
+func (p *LogsPump) checkpoint(id string) (time.Time, bool) {
+	if p.checkpoints == "" {
+		return time.Time{}, false
+	}
+	checkpoint, err := p.checkpoints.Get(id)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			debug("pump.checkpoint():", id, err)
+		}
+		return time.Time{}, false
+	}
+	return checkpoint, true
+}
+
+func (p *LogsPump) saveCheckpoint(id string, pump *containerPump) {
+	if p.checkpoints == "" {
+		return
+	}
+	p.checkpointMu.Lock()
+	defer p.checkpointMu.Unlock()
+	last := pump.checkpoint()
+	if last <= pump.savedTime {
+		// nothing was delivered since, or routes are still behind
+		return
+	}
+	if err := p.checkpoints.Set(id, time.Unix(0, last)); err != nil {
+		log.Println("pump.saveCheckpoint():", id, err)
+		return
+	}
+	pump.savedTime = last
+}
+
+func (p *LogsPump) removeCheckpoint(id string) {
+	if p.checkpoints == "" {
+		return
+	}
+	p.checkpointMu.Lock()
+	defer p.checkpointMu.Unlock()
+	p.checkpoints.Remove(id)
+}
+
+// saveCheckpoints periodically records how far each container's logs were delivered
+func (p *LogsPump) saveCheckpoints(interval time.Duration) {
+	for range time.Tick(interval) {
+		p.mu.Lock()
+		pumps := make(map[string]*containerPump, len(p.pumps))
+		for id, pump := range p.pumps {
+			pumps[id] = pump
+		}
+		p.mu.Unlock()
+		for id, pump := range pumps {
+			p.saveCheckpoint(id, pump)
+		}
+	}
+}
+
+// pruneCheckpoints removes checkpoints of containers that no longer exist
+func (p *LogsPump) pruneCheckpoints() {
+	ids, err := p.checkpoints.GetAll()
+	if err != nil {
+		debug("pump.pruneCheckpoints():", err)
+		return
+	}
+	containers, err := p.client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		debug("pump.pruneCheckpoints():", err)
+		return
+	}
+	exists := make(map[string]bool, len(containers))
+	for idx := range containers {
+		exists[normalID(containers[idx].ID)] = true
+	}
+	for _, id := range ids {
+		if !exists[id] {
+			debug("pump.pruneCheckpoints(): removing", id)
+			p.removeCheckpoint(id)
+		}
+	}
+}
+
 func (p *LogsPump) update(event *docker.APIEvents) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -319,11 +457,7 @@ func (p *LogsPump) RoutingFrom(id string) bool {
 func (p *LogsPump) Route(route *Route, logstream chan *Message) {
 	p.mu.Lock()
 	for _, pump := range p.pumps {
-		if route.MatchContainer(
-			normalID(pump.container.ID),
-			normalName(pump.container.Name),
-			pump.container.Config.Labels,
-		) {
+		if route.MatchDockerContainer(pump.container) {
 			pump.add(logstream, route)
 			defer pump.remove(logstream)
 		}
@@ -342,11 +476,7 @@ func (p *LogsPump) Route(route *Route, logstream chan *Message) {
 		case event := <-updates:
 			switch event.Status {
 			case pumpEventStatusStartName, pumpEventStatusRestartName:
-				if route.MatchContainer(
-					normalID(event.pump.container.ID),
-					normalName(event.pump.container.Name),
-					event.pump.container.Config.Labels,
-				) {
+				if route.MatchDockerContainer(event.pump.container) {
 					event.pump.add(logstream, route)
 					defer event.pump.remove(logstream)
 				}
@@ -364,9 +494,14 @@ func (p *LogsPump) Route(route *Route, logstream chan *Message) {
 }
 
 type containerPump struct {
+	lastTime int64  // accessed atomically, kept first for 64-bit alignment
+	messages uint64 // accessed atomically
+	bytes    uint64 // accessed atomically
 	sync.Mutex
 	container  *docker.Container
 	logstreams map[chan *Message]*Route
+	savedTime  int64
+	skipUntil  int64 // time of the checkpoint resumed from, set before pumping
 }
 
 func newContainerPump(container *docker.Container, stdout, stderr io.Reader) *containerPump {
@@ -374,10 +509,12 @@ func newContainerPump(container *docker.Container, stdout, stderr io.Reader) *co
 		container:  container,
 		logstreams: make(map[chan *Message]*Route),
 	}
+	maxLineLength := getMaxLineLengthFromEnv()
+	marker := cfg.GetEnvDefault("TRUNCATION_MARKER", defaultTruncationMarker)
 	pump := func(source string, input io.Reader) {
-		buf := bufio.NewReader(input)
+		lines := newLineReader(input, maxLineLength, marker)
 		for {
-			line, err := buf.ReadString('\n')
+			msgTime, data, err := lines.ReadLine()
 			if err != nil {
 				if err != io.EOF {
 					debug("pump.newContainerPump():", normalID(container.ID), source+":", err)
@@ -385,9 +522,9 @@ func newContainerPump(container *docker.Container, stdout, stderr io.Reader) *co
 				return
 			}
 			cp.send(&Message{
-				Data:      strings.TrimSuffix(line, "\n"),
+				Data:      data,
 				Container: container,
-				Time:      time.Now(),
+				Time:      msgTime,
 				Source:    source,
 			})
 		}
@@ -398,13 +535,58 @@ func newContainerPump(container *docker.Container, stdout, stderr io.Reader) *co
 }
 
 func (cp *containerPump) send(msg *Message) {
+	if cp.skipUntil != 0 && !msg.Time.IsZero() && msg.Time.UnixNano() <= cp.skipUntil {
+		// already pumped before the checkpoint was saved
+		return
+	}
+	atomic.AddUint64(&cp.messages, 1)
+	atomic.AddUint64(&cp.bytes, uint64(len(msg.Data)))
+	// enqueue without holding the lock, so a route blocking on a full queue
+	// doesn't hold up adding and removing the others
 	cp.Lock()
-	defer cp.Unlock()
+	routes := make(map[chan *Message]*Route, len(cp.logstreams))
 	for logstream, route := range cp.logstreams {
+		routes[logstream] = route
+	}
+	cp.Unlock()
+	for logstream, route := range routes {
 		if !route.MatchMessage(msg) {
 			continue
 		}
-		logstream <- msg
+		route.enqueue(logstream, msg)
+	}
+	if msg.Time.IsZero() {
+		return
+	}
+	// the stdout and stderr pumps race to record their last message
+	for t := msg.Time.UnixNano(); ; {
+		last := atomic.LoadInt64(&cp.lastTime)
+		if t <= last || atomic.CompareAndSwapInt64(&cp.lastTime, last, t) {
+			return
+		}
+	}
+}
+
+// checkpoint returns the time up to which the messages of the container were
+// delivered by all its routes
+func (cp *containerPump) checkpoint() int64 {
+	checkpoint := atomic.LoadInt64(&cp.lastTime)
+	cp.Lock()
+	defer cp.Unlock()
+	for _, route := range cp.logstreams {
+		if delivered, waiting := route.undelivered(cp.container.ID); waiting && delivered < checkpoint {
+			checkpoint = delivered
+		}
+	}
+	return checkpoint
+}
+
+// forgetDelivery stops the routes of the container tracking its messages
+func (cp *containerPump) forgetDelivery() {
+	cp.Lock()
+	defer cp.Unlock()
+	for _, route := range cp.logstreams {
+		route.forgetDelivery(cp.container.ID)
 	}
 }
 
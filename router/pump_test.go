@@ -3,12 +3,14 @@ package router
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 )
@@ -244,6 +246,52 @@ func TestPumpContainerPump(t *testing.T) {
 	}
 }
 
+func TestPumpMessageTimeFromDocker(t *testing.T) {
+	container := &docker.Container{
+		ID:     "8dfafdbc3a40",
+		Config: &docker.Config{},
+	}
+	outrd, outwr := io.Pipe()
+	errrd, errwr := io.Pipe()
+	defer errwr.Close()
+	pump := newContainerPump(container, outrd, errrd)
+	logstream, route := make(chan *Message), &Route{}
+	pump.add(logstream, route)
+
+	go outwr.Write([]byte("2021-02-03T04:05:06.123456789Z test data\n"))
+	msg := <-logstream
+	outwr.Close()
+	expected := time.Date(2021, 2, 3, 4, 5, 6, 123456789, time.UTC)
+	if !msg.Time.Equal(expected) {
+		t.Errorf("expected message time %v got %v", expected, msg.Time)
+	}
+	if msg.Data != "test data" {
+		t.Errorf("expected message data 'test data' got %q", msg.Data)
+	}
+}
+
+func TestPumpSkipsLinesBeforeCheckpoint(t *testing.T) {
+	container := &docker.Container{
+		ID:     "8dfafdbc3a40",
+		Config: &docker.Config{},
+	}
+	outrd, outwr := io.Pipe()
+	errrd, errwr := io.Pipe()
+	defer errwr.Close()
+	pump := newContainerPump(container, outrd, errrd)
+	pump.skipUntil = time.Date(2021, 2, 3, 4, 5, 6, 500000000, time.UTC).UnixNano()
+	logstream, route := make(chan *Message, 3), &Route{}
+	pump.add(logstream, route)
+
+	outwr.Write([]byte("2021-02-03T04:05:06.250000000Z before\n" +
+		"2021-02-03T04:05:06.500000000Z checkpoint\n" +
+		"2021-02-03T04:05:06.750000000Z after\n"))
+	if msg := <-logstream; msg.Data != "after" {
+		t.Errorf("expected only the line after the checkpoint, got %q", msg.Data)
+	}
+	outwr.Close()
+}
+
 func TestPumpRoutingFrom(t *testing.T) {
 	container := &docker.Container{
 		ID: "8dfafdbc3a40",
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	// QueueBlock makes the pump wait for room in a full route queue
+	QueueBlock = "block"
+	// QueueDropOldest discards the oldest queued message to make room for a new one
+	QueueDropOldest = "drop-oldest"
+	// QueueDropNewest discards new messages while the route queue is full
+	QueueDropNewest = "drop-newest"
+
+	defaultQueueSize = 1024
+	// defaultQueuePolicy keeps a full queue from stalling the other routes
+	// of its containers
+	defaultQueuePolicy = QueueDropOldest
+)
+
+// setupQueue validates the queue options of a route and creates its logstream
+func (r *Route) setupQueue() error {
+	size := defaultQueueSize
+	if s := r.Options["queue.size"]; s != "" {
+		var err error
+		if size, err = strconv.Atoi(s); err != nil || size < 0 {
+			return errors.New("bad queue.size: " + s)
+		}
+	}
+	policy := defaultQueuePolicy
+	if p := r.Options["queue.overflow"]; p != "" {
+		policy = p
+	}
+	switch policy {
+	case QueueBlock, QueueDropOldest, QueueDropNewest:
+	default:
+		return errors.New("bad queue.overflow: " + policy)
+	}
+	r.queuePolicy = policy
+	r.logstream = make(chan *Message, size)
+	return nil
+}
+
+// overflowPolicy returns the overflow policy of a route, which is the default
+// one for routes not set up by Add, like those of the logs HTTP streamer
+func (r *Route) overflowPolicy() string {
+	if r.queuePolicy == "" {
+		return defaultQueuePolicy
+	}
+	return r.queuePolicy
+}
+
+// enqueue hands a message to a route's logstream according to its overflow policy
+func (r *Route) enqueue(logstream chan *Message, msg *Message) {
+	switch r.overflowPolicy() {
+	case QueueDropNewest:
+		select {
+		case logstream <- msg:
+			r.countMessage(msg)
+		default:
+			atomic.AddUint64(&r.dropped, 1)
+		}
+	case QueueDropOldest:
+		for {
+			select {
+			case logstream <- msg:
+				r.countMessage(msg)
+				return
+			default:
+			}
+			// an unbuffered logstream has nothing to evict
+			if cap(logstream) == 0 {
+				atomic.AddUint64(&r.dropped, 1)
+				return
+			}
+			select {
+			case <-logstream:
+				atomic.AddUint64(&r.dropped, 1)
+			default:
+			}
+		}
+	case QueueBlock:
+		logstream <- msg
+		r.countMessage(msg)
+	}
+}
+
+// QueueStats describes the state of a route's queue
+type QueueStats struct {
+	Policy  string `json:"policy"`
+	Size    int    `json:"size"`
+	Length  int    `json:"length"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// QueueStats returns the current state of a route's queue
+func (r *Route) QueueStats() QueueStats {
+	return QueueStats{
+		Policy:  r.overflowPolicy(),
+		Size:    cap(r.logstream),
+		Length:  len(r.logstream),
+		Dropped: atomic.LoadUint64(&r.dropped),
+	}
+}
@@ -0,0 +1,183 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRouteSetupQueue(t *testing.T) {
+	route := &Route{}
+	if err := route.setupQueue(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if stats := route.QueueStats(); stats.Size != defaultQueueSize || stats.Policy != defaultQueuePolicy {
+		t.Errorf("expected default queue, got: %+v", stats)
+	}
+
+	route = &Route{Options: map[string]string{"queue.size": "2", "queue.overflow": QueueDropOldest}}
+	if err := route.setupQueue(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if stats := route.QueueStats(); stats.Size != 2 || stats.Policy != QueueDropOldest {
+		t.Errorf("expected queue of 2 dropping oldest, got: %+v", stats)
+	}
+
+	for _, opts := range []map[string]string{
+		{"queue.size": "-1"},
+		{"queue.size": "many"},
+		{"queue.overflow": "drop-all"},
+	} {
+		route = &Route{Options: opts}
+		if err := route.setupQueue(); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
+
+func TestRouteEnqueueDropNewest(t *testing.T) {
+	route := &Route{Options: map[string]string{"queue.size": "2", "queue.overflow": QueueDropNewest}}
+	if err := route.setupQueue(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, data := range []string{"a", "b", "c", "d"} {
+		route.enqueue(route.logstream, &Message{Data: data})
+	}
+	if stats := route.QueueStats(); stats.Length != 2 || stats.Dropped != 2 {
+		t.Errorf("expected 2 queued and 2 dropped, got: %+v", stats)
+	}
+	for _, expected := range []string{"a", "b"} {
+		if msg := <-route.logstream; msg.Data != expected {
+			t.Errorf("expected %s got %s", expected, msg.Data)
+		}
+	}
+}
+
+func TestRouteEnqueueDropOldest(t *testing.T) {
+	route := &Route{Options: map[string]string{"queue.size": "2", "queue.overflow": QueueDropOldest}}
+	if err := route.setupQueue(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for _, data := range []string{"a", "b", "c", "d"} {
+		route.enqueue(route.logstream, &Message{Data: data})
+	}
+	if stats := route.QueueStats(); stats.Length != 2 || stats.Dropped != 2 {
+		t.Errorf("expected 2 queued and 2 dropped, got: %+v", stats)
+	}
+	for _, expected := range []string{"c", "d"} {
+		if msg := <-route.logstream; msg.Data != expected {
+			t.Errorf("expected %s got %s", expected, msg.Data)
+		}
+	}
+}
+
+func TestRouteEnqueueUnbuffered(t *testing.T) {
+	for _, policy := range []string{QueueDropOldest, QueueDropNewest} {
+		route := &Route{Options: map[string]string{"queue.size": "0", "queue.overflow": policy}}
+		if err := route.setupQueue(); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		route.enqueue(route.logstream, &Message{Data: "a"})
+		if stats := route.QueueStats(); stats.Dropped != 1 {
+			t.Errorf("expected 1 dropped with %s, got: %+v", policy, stats)
+		}
+	}
+}
+
+func TestRouteEnqueueDefault(t *testing.T) {
+	route := &Route{Options: map[string]string{"queue.size": "1"}}
+	if err := route.setupQueue(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, data := range []string{"a", "b", "c"} {
+			route.enqueue(route.logstream, &Message{Data: data})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected a full queue not to block by default")
+	}
+	if stats := route.QueueStats(); stats.Length != 1 || stats.Dropped != 2 {
+		t.Errorf("expected 1 queued and 2 dropped, got: %+v", stats)
+	}
+	if msg := <-route.logstream; msg.Data != "c" {
+		t.Errorf("expected c got %s", msg.Data)
+	}
+}
+
+func TestPumpSendSlowRoute(t *testing.T) {
+	pump := &containerPump{logstreams: make(map[chan *Message]*Route)}
+	slow := &Route{Options: map[string]string{"queue.size": "1", "queue.overflow": QueueDropNewest}}
+	fast := &Route{}
+	for _, route := range []*Route{slow, fast} {
+		if err := route.setupQueue(); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		pump.add(route.logstream, route)
+	}
+	for i := 0; i < 3; i++ {
+		pump.send(&Message{Data: "test data"})
+	}
+	if stats := slow.QueueStats(); stats.Length != 1 || stats.Dropped != 2 {
+		t.Errorf("expected slow route to hold 1 and drop 2, got: %+v", stats)
+	}
+	if stats := fast.QueueStats(); stats.Length != 3 || stats.Dropped != 0 {
+		t.Errorf("expected fast route to hold 3 and drop 0, got: %+v", stats)
+	}
+	if c := slow.Counters(); c.Messages != 1 || c.Bytes != 9 || c.Dropped != 2 {
+		t.Errorf("expected slow route to count 1 message of 9 bytes, got: %+v", c)
+	}
+	if c := fast.Counters(); c.Messages != 3 || c.Bytes != 27 {
+		t.Errorf("expected fast route to count 3 messages of 27 bytes, got: %+v", c)
+	}
+	if pump.messages != 3 || pump.bytes != 27 {
+		t.Errorf("expected pump to count 3 messages of 27 bytes, got: %d and %d", pump.messages, pump.bytes)
+	}
+}
+
+func TestRouteEnqueueNotSetUp(t *testing.T) {
+	// routes of the logs HTTP streamer don't go through setupQueue
+	route := &Route{}
+	logstream := make(chan *Message, 1)
+	for _, data := range []string{"a", "b"} {
+		route.enqueue(logstream, &Message{Data: data})
+	}
+	if stats := route.QueueStats(); stats.Policy != defaultQueuePolicy || stats.Dropped != 1 {
+		t.Errorf("expected the default policy to drop 1, got: %+v", stats)
+	}
+	if msg := <-logstream; msg.Data != "b" {
+		t.Errorf("expected b got %s", msg.Data)
+	}
+}
+
+func TestPumpSendBlockedRoute(t *testing.T) {
+	pump := &containerPump{logstreams: make(map[chan *Message]*Route)}
+	blocked := &Route{Options: map[string]string{"queue.size": "0", "queue.overflow": QueueBlock}}
+	if err := blocked.setupQueue(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	pump.add(blocked.logstream, blocked)
+	sent := make(chan struct{})
+	go func() {
+		pump.send(&Message{Data: "test data"})
+		close(sent)
+	}()
+
+	other := make(chan *Message, 1)
+	added := make(chan struct{})
+	go func() {
+		pump.add(other, &Route{})
+		pump.remove(other)
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("expected a blocked route not to hold up adding routes")
+	}
+	<-blocked.logstream
+	<-sent
+}
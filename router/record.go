@@ -0,0 +1,54 @@
+package router
+
+import (
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// Record is a log message as adapters encode it to JSON
+type Record struct {
+	Time      time.Time              `json:"time"`
+	Message   string                 `json:"message"`
+	Source    string                 `json:"source"`
+	Host      string                 `json:"host"`
+	Container *RecordContainer       `json:"container,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// RecordContainer is the container of a log message encoded to JSON
+type RecordContainer struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Image  string            `json:"image"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// NewRecord returns the record of a log message read on host
+func NewRecord(message *Message, host string) *Record {
+	return &Record{
+		Time:      message.Time,
+		Message:   message.Data,
+		Source:    message.Source,
+		Host:      host,
+		Container: NewRecordContainer(message.Container),
+		Fields:    message.Fields,
+	}
+}
+
+// NewRecordContainer returns the record of a container, or nil without one
+func NewRecordContainer(c *docker.Container) *RecordContainer {
+	if c == nil {
+		return nil
+	}
+	container := &RecordContainer{
+		ID:   c.ID,
+		Name: strings.TrimPrefix(c.Name, "/"),
+	}
+	if c.Config != nil {
+		container.Image = c.Config.Image
+		container.Labels = c.Config.Labels
+	}
+	return container
+}
@@ -0,0 +1,34 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestNewRecord(t *testing.T) {
+	record := NewRecord(&Message{
+		Container: &docker.Container{
+			ID:     "8dfafdbc3a40",
+			Name:   "/web",
+			Config: &docker.Config{Image: "nginx:1.21", Labels: map[string]string{"team": "shop"}},
+		},
+		Source: "stdout",
+		Data:   "hello",
+		Time:   time.Date(2021, 12, 3, 10, 0, 0, 0, time.UTC),
+	}, "host1")
+	b, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"time":"2021-12-03T10:00:00Z","message":"hello","source":"stdout","host":"host1",` +
+		`"container":{"id":"8dfafdbc3a40","name":"web","image":"nginx:1.21","labels":{"team":"shop"}}}`
+	if string(b) != expected {
+		t.Errorf("expected %s got %s", expected, b)
+	}
+	if record := NewRecord(&Message{Data: "hello"}, "host1"); record.Container != nil {
+		t.Errorf("expected no container got %+v", record.Container)
+	}
+}
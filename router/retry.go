@@ -0,0 +1,104 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultRetryCount = 5
+
+var (
+	// RetryBackoff is the wait before the first retry, doubled after each one
+	RetryBackoff = 100 * time.Millisecond
+	// MaxRetryBackoff caps the wait between retries
+	MaxRetryBackoff = 30 * time.Second
+)
+
+// permanentError is an error Retry doesn't retry
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps an error so Retry gives up on it
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent returns whether an error was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// RetryCount returns the retry.count option of a route, how many times an
+// adapter retries a failed write
+func (r *Route) RetryCount() (int, error) {
+	return r.IntOption("retry.count", defaultRetryCount)
+}
+
+// Retry calls fn until it succeeds, returns a permanent error or has been
+// retried retries times, waiting with exponential backoff between calls.
+// It returns the last error of fn.
+func Retry(retries int, fn func() error) error {
+	return retry(retries, fn, func() {})
+}
+
+func retry(retries int, fn func() error, onRetry func()) error {
+	backoff := RetryBackoff
+	for try := 0; ; try++ {
+		err := fn()
+		if err == nil || try >= retries || IsPermanent(err) {
+			return err
+		}
+		onRetry()
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > MaxRetryBackoff {
+			backoff = MaxRetryBackoff
+		}
+	}
+}
+
+// HTTPError is the error of an HTTP response with a failure status
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// CheckHTTPResponse returns nil for a successful response, and an HTTPError
+// otherwise. The error is permanent unless the status is 408, 429 or 5xx,
+// which are worth retrying. The body of failed responses is consumed.
+func CheckHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err := &HTTPError{resp.StatusCode, strings.TrimSpace(string(body))}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return err
+	default:
+		return Permanent(err)
+	}
+}
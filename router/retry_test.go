@@ -0,0 +1,103 @@
+package router
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	RetryBackoff = time.Millisecond
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := Retry(3, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	err = Retry(2, func() error {
+		calls++
+		return errors.New("unavailable")
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("expected failure after 3 calls, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	err = Retry(5, func() error {
+		calls++
+		return Permanent(errors.New("bad request"))
+	})
+	if !IsPermanent(err) || err.Error() != "bad request" || calls != 1 {
+		t.Errorf("expected permanent failure after 1 call, got %d calls and %v", calls, err)
+	}
+}
+
+func TestRouteRetry(t *testing.T) {
+	route := &Route{}
+	if health := route.Health(); health.State != RouteConnected || health.LastWrite != nil || !health.Critical {
+		t.Errorf("expected a new route to be connected and critical, got: %+v", health)
+	}
+
+	var states []string
+	err := route.Retry(2, func() error {
+		states = append(states, route.Health().State)
+		return errors.New("unavailable")
+	})
+	if err == nil || route.Health().State != RouteFailed {
+		t.Errorf("expected failed route, got %v and %+v", err, route.Health())
+	}
+	if len(states) != 3 || states[1] != RouteRetrying || route.Counters().Retries != 2 {
+		t.Errorf("expected 2 retries, got states %v and %+v", states, route.Counters())
+	}
+
+	if err := route.Retry(2, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if health := route.Health(); health.State != RouteConnected || health.LastWrite == nil {
+		t.Errorf("expected connected route with a last write, got: %+v", health)
+	}
+
+	route.Options = map[string]string{"health.critical": "false"}
+	if route.Critical() {
+		t.Error("expected route not to be critical")
+	}
+}
+
+func TestCheckHTTPResponse(t *testing.T) {
+	for status, expected := range map[int]string{
+		200: "",
+		204: "",
+		400: "permanent",
+		401: "permanent",
+		408: "retry",
+		429: "retry",
+		500: "retry",
+		503: "retry",
+	} {
+		resp := &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader("details\n"))}
+		err := CheckHTTPResponse(resp)
+		switch {
+		case expected == "" && err != nil,
+			expected == "permanent" && !IsPermanent(err),
+			expected == "retry" && (err == nil || IsPermanent(err)):
+			t.Errorf("expected %s error for status %d got %v", expected, status, err)
+		}
+		var httpErr *HTTPError
+		if err != nil && (!errors.As(err, &httpErr) || httpErr.Body != "details") {
+			t.Errorf("expected HTTPError with body for status %d got %v", status, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Package routertest provides utilities for testing log adapters
+package routertest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// Stream streams messages to adapter, returning once it has handled them
+// and its stream is closed
+func Stream(adapter router.LogAdapter, messages ...*router.Message) {
+	stream := make(chan *router.Message, len(messages))
+	for _, message := range messages {
+		stream <- message
+	}
+	close(stream)
+	adapter.Stream(stream)
+}
+
+// Request is a request received by a server of NewServer
+type Request struct {
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// NewServer returns a server answering its first requests with statuses,
+// then sending the requests it receives to requests
+func NewServer(requests chan<- Request, statuses ...int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if len(statuses) > 0 {
+			status := statuses[0]
+			statuses = statuses[1:]
+			mu.Unlock()
+			w.WriteHeader(status)
+			return
+		}
+		mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- Request{r.URL.Path, r.Header, body}
+	}))
+}
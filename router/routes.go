@@ -78,6 +78,9 @@ func (rm *RouteManager) Remove(id string) bool {
 	if ok && route.closer != nil {
 		route.closer <- struct{}{}
 	}
+	if ok {
+		route.closeSpool(true)
+	}
 	delete(rm.routes, id)
 	if rm.persistor != nil {
 		rm.persistor.Remove(id)
@@ -97,6 +100,11 @@ func (rm *RouteManager) AddFromURI(uri string) error {
 		Adapter: u.Scheme,
 		Options: make(map[string]string),
 	}
+	// keep the path of URIs like https://example.com/logs apart from the
+	// address, for the adapters sending to URLs or files
+	if u.Path != "/" {
+		r.Path = u.Path
+	}
 	if u.RawQuery != "" {
 		params, err := url.ParseQuery(u.RawQuery)
 		if err != nil {
@@ -113,6 +121,20 @@ func (rm *RouteManager) AddFromURI(uri string) error {
 				r.FilterLabels = strings.Split(value, ",")
 			case "filter.sources":
 				r.FilterSources = strings.Split(value, ",")
+			case "filter.image":
+				r.FilterImage = value
+			case "filter.project":
+				r.FilterProject = value
+			case "filter.service":
+				r.FilterService = value
+			case "filter.network":
+				r.FilterNetwork = value
+			case "filter.match":
+				r.FilterMatch = value
+			case "filter.exclude":
+				r.FilterExclude = value
+			case "filter.expr":
+				r.FilterExpr = value
 			default:
 				r.Options[key] = value
 			}
@@ -129,8 +151,18 @@ func (rm *RouteManager) Add(route *Route) error {
 	if !found {
 		return errors.New("bad adapter: " + route.Adapter)
 	}
+	if err := route.setupMatch(); err != nil {
+		return err
+	}
+	if err := route.setupQueue(); err != nil {
+		return err
+	}
+	if err := route.setupFilters(); err != nil {
+		return err
+	}
 	adapter, err := factory(route)
 	if err != nil {
+		route.closeSpool(false)
 		return err
 	}
 	if route.ID == "" {
@@ -143,6 +175,7 @@ func (rm *RouteManager) Add(route *Route) error {
 	// Stop any existing route with this ID:
 	if rm.routes[route.ID] != nil {
 		rm.routes[route.ID].closer <- struct{}{}
+		rm.routes[route.ID].closeSpool(false)
 	}
 
 	rm.routes[route.ID] = route
@@ -158,9 +191,12 @@ func (rm *RouteManager) Add(route *Route) error {
 }
 
 func (rm *RouteManager) route(route *Route) {
-	logstream := make(chan *Message)
 	defer route.Close()
-	rm.Route(route, logstream)
+	rm.Route(route, route.logstream)
+	logstream := route.logstream
+	if len(route.filters) > 0 {
+		logstream = route.filterStream(logstream)
+	}
 	route.adapter.Stream(logstream)
 }
 
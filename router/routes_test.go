@@ -57,3 +57,25 @@ func TestRouterNoDuplicateIds(t *testing.T) {
 		t.Errorf("route1 was not closed after route2 added.")
 	}
 }
+
+func TestRouterAddFromURIAddress(t *testing.T) {
+	AdapterFactories.Register(newDummyAdapter, "dummy")
+	for uri, expected := range map[string][2]string{
+		"dummy://localhost:5000":                  {"localhost:5000", ""},
+		"dummy://localhost:5000/":                 {"localhost:5000", ""},
+		"dummy://example.com/services/collector":  {"example.com", "/services/collector"},
+		"dummy://example.com:8080/logs?batch=100": {"example.com:8080", "/logs"},
+		"dummy:///var/log/{{.ContainerName}}.log": {"", "/var/log/{{.ContainerName}}.log"},
+	} {
+		rm := &RouteManager{routes: make(map[string]*Route)}
+		if err := rm.AddFromURI(uri); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		for _, route := range rm.routes {
+			if route.Address != expected[0] || route.Path != expected[1] {
+				t.Errorf("expected address %s and path %s for %s got %s and %s",
+					expected[0], expected[1], uri, route.Address, route.Path)
+			}
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package router
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/logspout/cfg"
+)
+
+const (
+	spoolSegmentExt       = ".seg"
+	spoolOffsetFile       = "offset"
+	spoolRecordHeaderSize = 4
+	defaultSpoolMax       = 256 << 20
+	maxSpoolSegmentSize   = 8 << 20
+	minSpoolSegments      = 4
+)
+
+// SpoolFlushInterval is how often adapters retry a destination while messages are spooled
+var SpoolFlushInterval = 5 * time.Second
+
+var errSpoolClosed = errors.New("spool is closed")
+
+// openSpools holds the spools opened by routes, by directory, so that a route
+// replacing another one to the same destination shares its spool
+var openSpools = struct {
+	sync.Mutex
+	m map[string]*Spool
+}{m: make(map[string]*Spool)}
+
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+// parseSize parses a byte size such as 512MB
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	if !ok || i == 0 {
+		return 0, errors.New("bad size: " + s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
+// Spool is a disk-backed FIFO of rendered messages. Adapters append to it while
+// their destination is unreachable and replay it in order once it is back.
+// Its content survives restarts of logspout.
+type Spool struct {
+	mu          sync.Mutex
+	dir         string
+	max         int64
+	segmentSize int64
+	segments    []uint64
+	sizes       map[uint64]int64
+	offset      int64
+	offsetFile  *os.File
+	tail        *os.File
+	closed      bool
+	refs        int // routes using the spool, guarded by openSpools
+}
+
+// OpenSpool returns the disk spool configured for a route by its buffer options,
+// or nil when the route is not buffered to disk. The spool is closed when the
+// route is removed or replaced.
+func OpenSpool(route *Route) (*Spool, error) {
+	switch route.Options["buffer"] {
+	case "":
+		return nil, nil
+	case "disk":
+	default:
+		return nil, errors.New("bad buffer: " + route.Options["buffer"])
+	}
+	max := int64(defaultSpoolMax)
+	if s := route.Options["buffer.max"]; s != "" {
+		var err error
+		if max, err = parseSize(s); err != nil || max <= 0 {
+			return nil, errors.New("bad buffer.max: " + s)
+		}
+	}
+	dir := filepath.Join(cfg.GetEnvDefault("BUFFERPATH", "/mnt/buffer"), route.spoolKey())
+	openSpools.Lock()
+	defer openSpools.Unlock()
+	spool := openSpools.m[dir]
+	if spool != nil {
+		spool.mu.Lock()
+		spool.max = max
+		spool.mu.Unlock()
+	} else {
+		var err error
+		if spool, err = NewSpool(dir, max); err != nil {
+			return nil, err
+		}
+		openSpools.m[dir] = spool
+	}
+	spool.refs++
+	route.spool = spool
+	return spool, nil
+}
+
+// spoolKey identifies the destination of a route across restarts, when route
+// IDs may be regenerated and options like buffer.max may change
+func (r *Route) spoolKey() string {
+	b, _ := json.Marshal(struct {
+		Adapter, Address, Path string
+	}{r.Adapter, r.Address, r.Path})
+	return fmt.Sprintf("%x", sha1.Sum(b))[:12] //nolint:gosec
+}
+
+// closeSpool releases the spool of a route, deleting it with what is left
+// spooled when remove is true and no other route uses it
+func (r *Route) closeSpool(remove bool) {
+	if r.spool == nil {
+		return
+	}
+	openSpools.Lock()
+	defer openSpools.Unlock()
+	if r.spool.refs--; r.spool.refs > 0 {
+		return
+	}
+	delete(openSpools.m, r.spool.dir)
+	if err := r.spool.Close(); err != nil {
+		log.Println("spool:", err)
+	}
+	if remove {
+		if err := os.RemoveAll(r.spool.dir); err != nil {
+			log.Println("spool:", err)
+		}
+	}
+}
+
+// NewSpool opens or creates a spool in dir holding at most max bytes
+func NewSpool(dir string, max int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:         dir,
+		max:         max,
+		segmentSize: max / minSpoolSegments,
+		sizes:       make(map[uint64]int64),
+	}
+	if s.segmentSize > maxSpoolSegmentSize {
+		s.segmentSize = maxSpoolSegmentSize
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, seq)
+		s.sizes[seq] = file.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	if s.offsetFile, err = os.OpenFile(filepath.Join(dir, spoolOffsetFile), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return nil, err
+	}
+	var offset [8]byte
+	if _, err := s.offsetFile.ReadAt(offset[:], 0); err == nil && len(s.segments) > 0 {
+		s.offset = int64(binary.BigEndian.Uint64(offset[:]))
+	}
+	return s, nil
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// Empty returns whether the spool has no pending messages, or is closed
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed || s.pending() == 0
+}
+
+// Size returns the number of bytes pending in the spool
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending()
+}
+
+func (s *Spool) pending() int64 {
+	var size int64
+	for _, seq := range s.segments {
+		size += s.sizes[seq]
+	}
+	return size - s.offset
+}
+
+// Append adds a message to the end of the spool. When the spool is full its
+// oldest segment is discarded. Messages larger than a segment are rejected.
+func (s *Spool) Append(data []byte) error {
+	if int64(len(data)) > s.segmentSize {
+		return fmt.Errorf("message of %d bytes is larger than the spool segments", len(data))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSpoolClosed
+	}
+	if s.tail == nil || s.sizes[s.segments[len(s.segments)-1]] >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	record := make([]byte, spoolRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	copy(record[spoolRecordHeaderSize:], data)
+	n, err := s.tail.Write(record)
+	s.sizes[s.segments[len(s.segments)-1]] += int64(n)
+	if err != nil {
+		return err
+	}
+	for s.pending() > s.max && len(s.segments) > 1 {
+		log.Println("spool: full, discarding", s.sizes[s.segments[0]]-s.offset, "bytes from", s.dir)
+		if err := s.removeHead(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotate starts a new tail segment
+func (s *Spool) rotate() error {
+	if s.tail != nil {
+		if err := s.tail.Close(); err != nil {
+			return err
+		}
+		s.tail = nil
+	}
+	var seq uint64
+	if len(s.segments) > 0 {
+		seq = s.segments[len(s.segments)-1] + 1
+	}
+	tail, err := os.OpenFile(s.segmentPath(seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.tail = tail
+	s.segments = append(s.segments, seq)
+	s.sizes[seq] = 0
+	return nil
+}
+
+// removeHead deletes the oldest segment of the spool
+func (s *Spool) removeHead() error {
+	seq := s.segments[0]
+	if len(s.segments) == 1 && s.tail != nil {
+		if err := s.tail.Close(); err != nil {
+			return err
+		}
+		s.tail = nil
+	}
+	s.segments = s.segments[1:]
+	delete(s.sizes, seq)
+	if err := s.setOffset(0); err != nil {
+		return err
+	}
+	return os.Remove(s.segmentPath(seq))
+}
+
+func (s *Spool) setOffset(offset int64) error {
+	s.offset = offset
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(offset))
+	_, err := s.offsetFile.WriteAt(b[:], 0)
+	return err
+}
+
+// Flush replays spooled messages in order with write, removing each one once
+// written. It stops at the first error, leaving the failed message spooled.
+func (s *Spool) Flush(write func([]byte) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSpoolClosed
+	}
+	for len(s.segments) > 0 {
+		if err := s.flushHead(write); err != nil {
+			return err
+		}
+		if err := s.removeHead(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spool) flushHead(write func([]byte) error) error {
+	file, err := os.Open(s.segmentPath(s.segments[0]))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Seek(s.offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(file)
+	var header [spoolRecordHeaderSize]byte
+	for {
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			// EOF, or a record cut short by a crash
+			return nil
+		}
+		size := int64(binary.BigEndian.Uint32(header[:]))
+		if size > s.segmentSize {
+			log.Println("spool: discarding corrupt segment", s.segmentPath(s.segments[0]))
+			return nil
+		}
+		data := make([]byte, size)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil
+		}
+		if err = write(data); err != nil {
+			return err
+		}
+		if err = s.setOffset(s.offset + int64(spoolRecordHeaderSize+len(data))); err != nil {
+			return err
+		}
+	}
+}
+
+// Replay dials transport and, once connected, flushes the spool to the new
+// connection. The connection is returned for further writes.
+func (s *Spool) Replay(transport AdapterTransport, addr string, options map[string]string) (net.Conn, error) {
+	conn, err := transport.Dial(addr, options)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Flush(func(data []byte) error {
+		_, werr := conn.Write(data)
+		return werr
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Close releases the files held by the spool
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.tail != nil {
+		s.tail.Close()
+		s.tail = nil
+	}
+	return s.offsetFile.Close()
+}
@@ -0,0 +1,273 @@
+package router
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+type spoolTestTransport struct {
+	conn net.Conn
+	err  error
+}
+
+func (t *spoolTestTransport) Dial(addr string, options map[string]string) (net.Conn, error) {
+	return t.conn, t.err
+}
+
+func newTestSpool(t *testing.T, max int64) (*Spool, string) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool, err := NewSpool(dir, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spool, dir
+}
+
+func flushAll(t *testing.T, spool *Spool) []string {
+	var out []string
+	err := spool.Flush(func(data []byte) error {
+		out = append(out, string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return out
+}
+
+func TestSpoolParseSize(t *testing.T) {
+	sizes := []struct {
+		in  string
+		out int64
+	}{
+		{"1024", 1024},
+		{"10B", 10},
+		{"2KB", 2 << 10},
+		{"512MB", 512 << 20},
+		{"1gb", 1 << 30},
+	}
+	for _, size := range sizes {
+		if actual, err := parseSize(size.in); err != nil || actual != size.out {
+			t.Errorf("expected %d got %d (%v) for %s", size.out, actual, err, size.in)
+		}
+	}
+	for _, bad := range []string{"", "MB", "12TB", "1.5MB"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestSpoolOpen(t *testing.T) {
+	if spool, err := OpenSpool(&Route{}); spool != nil || err != nil {
+		t.Errorf("expected no spool and no error, got %v %v", spool, err)
+	}
+	if _, err := OpenSpool(&Route{Options: map[string]string{"buffer": "memory"}}); err == nil {
+		t.Error("expected error for unknown buffer type")
+	}
+	if _, err := OpenSpool(&Route{Options: map[string]string{"buffer": "disk", "buffer.max": "lots"}}); err == nil {
+		t.Error("expected error for bad buffer.max")
+	}
+}
+
+func TestSpoolFlushInOrder(t *testing.T) {
+	spool, dir := newTestSpool(t, 1<<20)
+	defer os.RemoveAll(dir)
+	defer spool.Close()
+
+	if !spool.Empty() {
+		t.Fatal("expected new spool to be empty")
+	}
+	for i := 0; i < 10; i++ {
+		if err := spool.Append([]byte("message " + strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := flushAll(t, spool)
+	if len(out) != 10 {
+		t.Fatalf("expected 10 messages got %d", len(out))
+	}
+	for i, msg := range out {
+		if expected := "message " + strconv.Itoa(i); msg != expected {
+			t.Errorf("expected %s got %s", expected, msg)
+		}
+	}
+	if !spool.Empty() {
+		t.Error("expected spool to be empty after flush")
+	}
+}
+
+func TestSpoolFlushStopsOnError(t *testing.T) {
+	spool, dir := newTestSpool(t, 1<<20)
+	defer os.RemoveAll(dir)
+	defer spool.Close()
+
+	for _, msg := range []string{"a", "b", "c"} {
+		spool.Append([]byte(msg))
+	}
+	err := spool.Flush(func(data []byte) error {
+		if string(data) == "b" {
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected flush error")
+	}
+	if out := flushAll(t, spool); len(out) != 2 || out[0] != "b" || out[1] != "c" {
+		t.Errorf("expected [b c] to remain spooled, got %v", out)
+	}
+}
+
+func TestSpoolSurvivesReopen(t *testing.T) {
+	spool, dir := newTestSpool(t, 1<<20)
+	defer os.RemoveAll(dir)
+
+	for _, msg := range []string{"a", "b", "c"} {
+		spool.Append([]byte(msg))
+	}
+	spool.Flush(func(data []byte) error {
+		if string(data) == "b" {
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+	spool.Close()
+
+	spool, err := NewSpool(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	spool.Append([]byte("d"))
+	out := flushAll(t, spool)
+	if len(out) != 3 || out[0] != "b" || out[1] != "c" || out[2] != "d" {
+		t.Errorf("expected [b c d] after reopen, got %v", out)
+	}
+}
+
+func TestSpoolDiscardsOldestWhenFull(t *testing.T) {
+	spool, dir := newTestSpool(t, 100)
+	defer os.RemoveAll(dir)
+	defer spool.Close()
+
+	for i := 0; i < 100; i++ {
+		spool.Append([]byte(strconv.Itoa(i)))
+	}
+	if size := spool.Size(); size > 100 {
+		t.Errorf("expected spool to hold at most 100 bytes, got %d", size)
+	}
+	out := flushAll(t, spool)
+	if len(out) == 0 || out[len(out)-1] != "99" {
+		t.Errorf("expected newest message to be kept, got %v", out)
+	}
+}
+
+func TestSpoolDiscardsCorruptSegment(t *testing.T) {
+	spool, dir := newTestSpool(t, 1<<20)
+	defer os.RemoveAll(dir)
+	defer spool.Close()
+
+	if err := spool.Append(make([]byte, spool.segmentSize+1)); err == nil {
+		t.Error("expected error for a message larger than a segment")
+	}
+	spool.Append([]byte("a"))
+	// a corrupt record header claiming a multi-GB record
+	if _, err := spool.tail.Write([]byte{0xff, 0xff, 0xff, 0xff, 'b'}); err != nil {
+		t.Fatal(err)
+	}
+	spool.sizes[spool.segments[0]] += 5
+	if out := flushAll(t, spool); len(out) != 1 || out[0] != "a" {
+		t.Errorf("expected [a] before the corrupt record, got %v", out)
+	}
+	if !spool.Empty() {
+		t.Error("expected corrupt segment to be discarded")
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	spool, dir := newTestSpool(t, 1<<20)
+	defer os.RemoveAll(dir)
+	defer spool.Close()
+	spool.Append([]byte("a\n"))
+	spool.Append([]byte("b\n"))
+
+	if _, err := spool.Replay(&spoolTestTransport{err: errors.New("down")}, "", nil); err == nil {
+		t.Fatal("expected replay to fail while transport is down")
+	}
+	if spool.Empty() {
+		t.Fatal("expected spool to keep messages while transport is down")
+	}
+
+	client, server := net.Pipe()
+	received := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(server)
+		received <- string(b)
+	}()
+	conn, err := spool.Replay(&spoolTestTransport{conn: client}, "", nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	conn.Close()
+	if data := <-received; data != "a\nb\n" {
+		t.Errorf("expected replayed data 'a\\nb\\n' got %q", data)
+	}
+	if !spool.Empty() {
+		t.Error("expected spool to be empty after replay")
+	}
+}
+
+func TestSpoolKey(t *testing.T) {
+	route := &Route{Adapter: "syslog+tcp", Address: "logs:514", Options: map[string]string{"buffer": "disk"}}
+	resized := &Route{Adapter: "syslog+tcp", Address: "logs:514", Options: map[string]string{"buffer": "disk", "buffer.max": "1GB"}}
+	if route.spoolKey() != resized.spoolKey() {
+		t.Error("expected resizing the buffer to keep the spool")
+	}
+	other := &Route{Adapter: "syslog+tcp", Address: "archive:514", Options: map[string]string{"buffer": "disk"}}
+	if route.spoolKey() == other.spoolKey() {
+		t.Error("expected another destination to have its own spool")
+	}
+}
+
+func TestSpoolCloseRoute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("BUFFERPATH", dir)
+	defer os.Unsetenv("BUFFERPATH")
+
+	options := map[string]string{"buffer": "disk"}
+	route := &Route{Adapter: "syslog+tcp", Address: "logs:514", Options: options}
+	replacement := &Route{Adapter: "syslog+tcp", Address: "logs:514", Options: options}
+	spool, err := OpenSpool(route)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if shared, err := OpenSpool(replacement); err != nil || shared != spool {
+		t.Fatalf("expected the replacing route to share the spool, got %v %v", shared, err)
+	}
+	spool.Append([]byte("a\n"))
+
+	route.closeSpool(false)
+	if err := spool.Append([]byte("b\n")); err != nil {
+		t.Fatal("expected the spool to stay open for the replacing route, got:", err)
+	}
+	replacement.closeSpool(true)
+	if err := spool.Append([]byte("c\n")); err != errSpoolClosed {
+		t.Errorf("expected closed spool error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, route.spoolKey())); !os.IsNotExist(err) {
+		t.Errorf("expected the spool of a removed route to be deleted, got %v", err)
+	}
+}
@@ -1,10 +1,11 @@
-//go:generate go-extpoints . AdapterFactory HttpHandler AdapterTransport LogRouter Job
+//go:generate go-extpoints . AdapterFactory HttpHandler AdapterTransport LogRouter Job LogFilterFactory
 package router
 
 import (
 	"net"
 	"net/http"
 	"path"
+	"regexp"
 	"strings"
 	"time"
 
@@ -27,6 +28,17 @@ type LogAdapter interface {
 	Stream(logstream chan *Message)
 }
 
+// LogFilterFactory is an extension type for adding new log filters
+type LogFilterFactory func(route *Route) (LogFilter, error)
+
+// LogFilter transforms messages on their way to a route's adapter. Filter
+// returns the message to pass on, or nil to drop it. Messages are shared
+// between routes, so a filter must return a modified copy rather than
+// changing the message it was given.
+type LogFilter interface {
+	Filter(message *Message) *Message
+}
+
 // Job is a thing to be done
 type Job interface {
 	Run() error
@@ -54,19 +66,39 @@ type Message struct {
 	Source    string
 	Data      string
 	Time      time.Time
+	Fields    map[string]interface{} `json:",omitempty"`
 }
 
 // Route represents what subset of logs should go where
 type Route struct {
+	dropped       uint64            // accessed atomically, kept first for 64-bit alignment
+	counters      routeCounters     // accessed atomically
+	health        routeHealth       // accessed atomically
 	ID            string            `json:"id"`
 	FilterID      string            `json:"filter_id,omitempty"`
 	FilterName    string            `json:"filter_name,omitempty"`
 	FilterSources []string          `json:"filter_sources,omitempty"`
 	FilterLabels  []string          `json:"filter_labels,omitempty"`
+	FilterImage   string            `json:"filter_image,omitempty"`
+	FilterProject string            `json:"filter_project,omitempty"`
+	FilterService string            `json:"filter_service,omitempty"`
+	FilterNetwork string            `json:"filter_network,omitempty"`
+	FilterMatch   string            `json:"filter_match,omitempty"`
+	FilterExclude string            `json:"filter_exclude,omitempty"`
+	FilterExpr    string            `json:"filter_expr,omitempty"`
 	Adapter       string            `json:"adapter"`
 	Address       string            `json:"address"`
+	Path          string            `json:"path,omitempty"`
 	Options       map[string]string `json:"options,omitempty"`
 	adapter       LogAdapter
+	logstream     chan *Message
+	queuePolicy   string
+	spool         *Spool
+	delivery      routeDelivery
+	filters       []LogFilter
+	match         *regexp.Regexp
+	exclude       *regexp.Regexp
+	expr          exprNode
 	closed        bool
 	closer        chan struct{}
 	closerRcv     <-chan struct{} // used instead of closer when set
@@ -105,22 +137,61 @@ func (r *Route) Close() {
 }
 
 func (r *Route) matchAll() bool {
-	if r.FilterID == "" && r.FilterName == "" && len(r.FilterSources) == 0 && len(r.FilterLabels) == 0 {
+	if r.FilterID == "" && r.FilterName == "" && len(r.FilterSources) == 0 && len(r.FilterLabels) == 0 && r.expr == nil &&
+		!r.filterDetails() {
 		return true
 	}
 	return false
 }
 
+// filterDetails returns whether the Route filters on images, compose projects, swarm services or networks
+func (r *Route) filterDetails() bool {
+	return r.FilterImage != "" || r.FilterProject != "" || r.FilterService != "" || r.FilterNetwork != ""
+}
+
 // MultiContainer returns whether the Route is matching multiple containers or not
 func (r *Route) MultiContainer() bool {
-	return r.matchAll() || strings.Contains(r.FilterName, "*")
+	return r.matchAll() || strings.Contains(r.FilterName, "*") || r.expr != nil || r.filterDetails()
 }
 
-// MatchContainer returns whether the Route is responsible for a given container
+// MatchDockerContainer returns whether the Route is responsible for a given
+// container, including its image, compose project, swarm service and networks
+func (r *Route) MatchDockerContainer(container *docker.Container) bool {
+	if r.matchAll() {
+		return true
+	}
+	if r.FilterImage != "" && !matchAny(r.FilterImage, containerImages(container)) {
+		return false
+	}
+	if r.FilterNetwork != "" && !matchAny(r.FilterNetwork, containerNetworks(container)) {
+		return false
+	}
+	if r.expr != nil && r.expr.eval(containerExprEnv(container)) == exprFalse {
+		return false
+	}
+	var labels map[string]string
+	if container.Config != nil {
+		labels = container.Config.Labels
+	}
+	return r.matchContainer(normalID(container.ID), normalName(container.Name), labels)
+}
+
+// MatchContainer returns whether the Route is responsible for a given container.
+// Filters on images and networks are only applied by MatchDockerContainer.
 func (r *Route) MatchContainer(id, name string, labels map[string]string) bool {
 	if r.matchAll() {
 		return true
 	}
+	if r.expr != nil {
+		env := &exprEnv{container: true, id: id, name: name, labels: labels}
+		if r.expr.eval(env) == exprFalse {
+			return false
+		}
+	}
+	return r.matchContainer(id, name, labels)
+}
+
+func (r *Route) matchContainer(id, name string, labels map[string]string) bool {
 	if r.FilterID != "" && !strings.HasPrefix(id, r.FilterID) {
 		return false
 	}
@@ -128,6 +199,12 @@ func (r *Route) MatchContainer(id, name string, labels map[string]string) bool {
 	if err != nil || (r.FilterName != "" && !match) {
 		return false
 	}
+	if r.FilterProject != "" && !matchGlob(r.FilterProject, labels[composeProjectLabel]) {
+		return false
+	}
+	if r.FilterService != "" && !matchGlob(r.FilterService, labels[swarmServiceLabel]) {
+		return false
+	}
 	for _, label := range r.FilterLabels {
 		labelParts := strings.SplitN(label, ":", 2)
 		if len(labelParts) > 1 {
@@ -145,13 +222,16 @@ func (r *Route) MatchContainer(id, name string, labels map[string]string) bool {
 
 // MatchMessage returns whether the Route is responsible for a given Message
 func (r *Route) MatchMessage(message *Message) bool {
-	if r.matchAll() {
+	if r.matchAll() && r.match == nil && r.exclude == nil {
 		return true
 	}
 	if len(r.FilterSources) > 0 && !contains(r.FilterSources, message.Source) {
 		return false
 	}
-	return true
+	if r.expr != nil && r.expr.eval(messageExprEnv(message)) == exprFalse {
+		return false
+	}
+	return r.matchContent(message.Data)
 }
 
 func contains(strs []string, str string) bool {
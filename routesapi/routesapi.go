@@ -27,7 +27,18 @@ func RoutesAPI() http.Handler {
 			http.NotFound(w, req)
 			return
 		}
-		w.Write(append(marshal(route), '\n'))
+		w.Write(append(marshal(redact(route)), '\n'))
+	}).Methods("GET")
+
+	r.HandleFunc("/routes/{id}/queue", func(w http.ResponseWriter, req *http.Request) {
+		params := mux.Vars(req)
+		route, _ := routes.Get(params["id"])
+		if route == nil {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(append(marshal(route.QueueStats()), '\n'))
 	}).Methods("GET")
 
 	r.HandleFunc("/routes/{id}", func(w http.ResponseWriter, req *http.Request) {
@@ -40,7 +51,11 @@ func RoutesAPI() http.Handler {
 	r.HandleFunc("/routes", func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Add("Content-Type", "application/json")
 		rts, _ := routes.GetAll()
-		w.Write(append(marshal(rts), '\n'))
+		shown := make([]*redactedRoute, 0, len(rts))
+		for _, route := range rts {
+			shown = append(shown, redact(route))
+		}
+		w.Write(append(marshal(shown), '\n'))
 	}).Methods("GET")
 
 	r.HandleFunc("/routes", func(w http.ResponseWriter, req *http.Request) {
@@ -56,12 +71,23 @@ func RoutesAPI() http.Handler {
 		}
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		w.Write(append(marshal(route), '\n'))
+		w.Write(append(marshal(redact(route)), '\n'))
 	}).Methods("POST")
 
 	return r
 }
 
+// redactedRoute is a route served with the values of its secret options
+// redacted, since the routes API isn't authenticated
+type redactedRoute struct {
+	*router.Route
+	Options map[string]string `json:"options,omitempty"`
+}
+
+func redact(route *router.Route) *redactedRoute {
+	return &redactedRoute{route, route.RedactedOptions()}
+}
+
 func marshal(obj interface{}) []byte {
 	bytes, err := json.MarshalIndent(obj, "", "  ")
 	if err != nil {